@@ -7,11 +7,15 @@ import (
 	"path/filepath"
 
 	"github.com/dvob/vu/internal/cloudinit"
+	"github.com/dvob/vu/internal/vm"
 	"github.com/spf13/cobra"
 )
 
 type cloudInitOptions struct {
 	config *cloudinit.Config
+	// profileNetworkConfig is the network config of the profiles and
+	// directories
+	profileNetworkConfig *cloudinit.NetworkConfig
 
 	name          string
 	user          string
@@ -20,6 +24,11 @@ type cloudInitOptions struct {
 	passwordHash  string
 
 	networkOptions cloudinit.NetworkConfigOptions
+	nicFlags       []string
+	nics           []nicOptions
+	// dhcpReservation uses DHCP reservations for all interfaces
+	dhcpReservation bool
+	macMode         string
 
 	profiles []string
 	dirs     []string
@@ -84,15 +93,7 @@ func (o *cloudInitOptions) complete() error {
 	if err != nil {
 		return err
 	}
-
-	// construct network config
-	networkConfig, err := cloudinit.NewNetworkConfig(o.networkOptions)
-	if err != nil {
-		return err
-	}
-	if networkConfig != nil {
-		o.config.NetworkConfig = networkConfig
-	}
+	o.profileNetworkConfig = o.config.NetworkConfig
 
 	// set general defaults
 	if o.config.UserData == nil {
@@ -106,13 +107,134 @@ func (o *cloudInitOptions) complete() error {
 	return o.config.Merge(c)
 }
 
+// MAC modes which define how MAC addresses are generated.
+const (
+	// macModeName derives the MAC addresses from the name of the VM
+	macModeName = "name"
+	// macModeRandom generates random MAC addresses
+	macModeRandom = "random"
+)
+
+// autoAddress is the address which is replaced by an allocated address.
+const autoAddress = "auto"
+
+// addressFunc is called for each network interface to allocate or reserve
+// the addresses of the interface. The index of the first interface is 0.
+type addressFunc func(index int, nic *nicOptions) error
+
+// completeNetwork sets up the network interfaces and constructs the network
+// config. Since the generated MAC addresses and the allocated addresses
+// differ for each VM, it has to be called for each VM. If addresses is nil,
+// addresses can not be allocated.
+func (o *cloudInitOptions) completeNetwork(addresses addressFunc) error {
+	if len(o.nicFlags) == 0 {
+		o.nics = []nicOptions{
+			{
+				NetworkConfigOptions: o.networkOptions,
+			},
+		}
+	} else {
+		if len(o.networkOptions.Addresses) > 0 || len(o.networkOptions.Gateways) > 0 || len(o.networkOptions.Nameserver) > 0 || o.networkOptions.DHCP6 || o.networkOptions.SLAAC {
+			return fmt.Errorf("--ip, --gateway, --dns, --dhcp6 and --slaac can not be combined with --nic")
+		}
+		o.nics = []nicOptions{}
+		for _, nicFlag := range o.nicFlags {
+			nic, err := parseNIC(nicFlag)
+			if err != nil {
+				return err
+			}
+			o.nics = append(o.nics, *nic)
+		}
+	}
+
+	// each interface gets a MAC address so that the configuration is
+	// matched exactly and DHCP reservations can be made
+	networkOptions := []cloudinit.NetworkConfigOptions{}
+	explicit := len(o.nics) > 1
+	for i := range o.nics {
+		o.nics[i].reservation = o.nics[i].reservation || o.dhcpReservation
+		explicit = explicit || o.nics[i].MAC != ""
+		if o.nics[i].MAC == "" {
+			mac, err := o.generateMAC(i)
+			if err != nil {
+				return err
+			}
+			o.nics[i].MAC = mac
+		}
+
+		if addresses != nil {
+			err := addresses(i, &o.nics[i])
+			if err != nil {
+				return err
+			}
+		} else if contains(autoAddress, o.nics[i].Addresses) || o.nics[i].reservation {
+			return fmt.Errorf("address %s and DHCP reservations are only supported on create", autoAddress)
+		}
+		nic := o.nics[i].NetworkConfigOptions
+		explicit = explicit || len(nic.Addresses) > 0 || len(nic.Gateways) > 0 || len(nic.Nameserver) > 0 || nic.DHCP6 || nic.SLAAC
+		networkOptions = append(networkOptions, nic)
+	}
+
+	// the generated MAC addresses alone do not replace the network config
+	// of the profiles
+	if o.profileNetworkConfig != nil && !explicit {
+		o.config.NetworkConfig = o.profileNetworkConfig
+		return nil
+	}
+	networkConfig, err := cloudinit.NewNetworkConfig(networkOptions...)
+	if err != nil {
+		return err
+	}
+	if o.profileNetworkConfig != nil {
+		fmt.Fprintf(os.Stderr, "the network config of the profiles is replaced by the interface configuration of vm '%s'\n", o.name)
+	}
+	o.config.NetworkConfig = networkConfig
+	return nil
+}
+
+// checkCount returns an error if the options can not be used for count VMs.
+// An explicit MAC address would be assigned to each of the VMs.
+func (o *cloudInitOptions) checkCount(count int) error {
+	if count < 2 {
+		return nil
+	}
+	for _, nicFlag := range o.nicFlags {
+		nic, err := parseNIC(nicFlag)
+		if err != nil {
+			return err
+		}
+		if nic.MAC != "" {
+			return fmt.Errorf("mac=%s in --nic can only be used to create a single vm", nic.MAC)
+		}
+	}
+	return nil
+}
+
+// generateMAC returns a MAC address for the interface according to the MAC
+// mode.
+func (o *cloudInitOptions) generateMAC(index int) (string, error) {
+	switch o.macMode {
+	case macModeName:
+		return vm.NameMAC(o.name, index), nil
+	case macModeRandom:
+		return vm.RandomMAC()
+	default:
+		return "", fmt.Errorf("invalid MAC mode '%s': use %s or %s", o.macMode, macModeName, macModeRandom)
+	}
+}
+
 func (o *cloudInitOptions) bindFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&o.user, "user", "", "user name to create in the during startup")
 	cmd.Flags().StringVar(&o.sshPubKey, "ssh-pub-key", "", "ssh public key to use")
 	cmd.Flags().StringVar(&o.passwordHash, "password-hash", "", "Password hash to login without SSH over console. The hash can be generated with openssl passwd.")
-	cmd.Flags().StringVar(&o.networkOptions.Address, "ip", "", "configure static IPv4 address insted of using DHCP. address has to be specified in CIDR notation.")
-	cmd.Flags().StringVar(&o.networkOptions.Gateway, "gateway", "", "the default IPv4 gateway. if no gateway is configured the lowest IP")
+	cmd.Flags().StringSliceVar(&o.networkOptions.Addresses, "ip", []string{}, "configure static IPv4 and/or IPv6 addresses. addresses have to be specified in CIDR notation. with auto a free IPv4 address of the network is allocated. without an IPv4 address DHCP is used for IPv4.")
+	cmd.Flags().StringSliceVar(&o.networkOptions.Gateways, "gateway", []string{}, "the default IPv4 and/or IPv6 gateway. if no gateway is configured the lowest IP of the network of the address is used.")
+	cmd.Flags().BoolVar(&o.networkOptions.DHCP6, "dhcp6", false, "use DHCPv6")
+	cmd.Flags().BoolVar(&o.networkOptions.SLAAC, "slaac", false, "use SLAAC (accept IPv6 router advertisements)")
 	cmd.Flags().StringSliceVar(&o.networkOptions.Nameserver, "dns", []string{}, "configure the dns server address. if no address is configured the default gateway is used.")
+	cmd.Flags().BoolVar(&o.dhcpReservation, "dhcp-reservation", false, "assign the IPv4 addresses with DHCP reservations in the network instead of a static configuration in the VM. without an IPv4 address a free address is allocated.")
+	cmd.Flags().StringVar(&o.macMode, "mac-mode", macModeName, "how MAC addresses are generated for interfaces without a MAC address: name (derived from the VM name) or random")
+	cmd.Flags().StringArrayVar(&o.nicFlags, "nic", []string{}, "add a network interface (e.g. network=lab,ip=10.0.0.5/24,ip=fd00::5/64,gateway=10.0.0.1,dns=10.0.0.1,dhcp6=true,slaac=true,mac=52:54:00:00:00:01). ip=auto allocates a free address. with reservation=true the IPv4 address is assigned with a DHCP reservation. can be repeated. replaces --ip, --gateway, --dns, --dhcp6 and --slaac.")
 	cmd.Flags().StringSliceVar(&o.profiles, "profile", []string{}, "base profile which want to use for our configuration")
 	cmd.Flags().StringSliceVar(&o.dirs, "dir", []string{}, "use configuration from directory as base configuration")
 }
@@ -141,6 +263,10 @@ func newConfigShowCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			err = o.completeNetwork(nil)
+			if err != nil {
+				return err
+			}
 
 			output, err := o.config.String()
 			if err != nil {
@@ -172,6 +298,10 @@ func newConfigWriteCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			err = o.completeNetwork(nil)
+			if err != nil {
+				return err
+			}
 
 			if iso {
 				isoData, err := o.config.ISO()
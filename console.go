@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	vu "github.com/dvob/vu/internal"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// escapeKey closes the console (Ctrl+]).
+const escapeKey = 0x1d
+
+func newConsoleCmd(mgr *vu.Manager) *cobra.Command {
+	var (
+		logFile  string
+		force    bool
+		readOnly bool
+	)
+	cmd := &cobra.Command{
+		Use:   "console NAME",
+		Short: "connect to the serial console of a VM",
+		Long: `Connects to the serial console of a running VM until the VM stops or the
+console is closed with Ctrl+]. The libvirt connection of vu only supports
+the output of the console, so for input 'virsh console' is run with the URI
+of the context. Without virsh or with --read-only only the output is shown.
+
+With --log the output is appended to a file instead, which allows to capture
+the boot log of a VM (e.g. with 'vu start NAME && vu console --log boot.log NAME').`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if logFile != "" {
+				file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				return mgr.VM.Console(name, file, force)
+			}
+
+			fd := int(os.Stdin.Fd())
+			if !term.IsTerminal(fd) {
+				return mgr.VM.Console(name, os.Stdout, force)
+			}
+			if !readOnly {
+				virsh, err := exec.LookPath("virsh")
+				if err == nil {
+					return virshConsole(mgr, virsh, name, force)
+				}
+				fmt.Fprintf(os.Stderr, "virsh not found, the console is read-only\n")
+			}
+			// raw mode to read the escape key without a newline
+			state, err := term.MakeRaw(fd)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = term.Restore(fd, state)
+			}()
+
+			fmt.Fprintf(os.Stderr, "connected to console of vm '%s' (read-only), escape character is ^]\r\n", name)
+			done := make(chan error, 2)
+			go func() {
+				done <- mgr.VM.Console(name, os.Stdout, force)
+			}()
+			go func() {
+				waitForKey(os.Stdin, escapeKey)
+				done <- nil
+			}()
+			return <-done
+		},
+		ValidArgsFunction: completeVMFunc(mgr),
+	}
+	cmd.Flags().StringVar(&logFile, "log", "", "append the output to a file")
+	cmd.Flags().BoolVar(&force, "force", false, "disconnect other console sessions")
+	cmd.Flags().BoolVar(&readOnly, "read-only", false, "only show the output of the console")
+	return cmd
+}
+
+// virshConsole runs virsh console, which supports input on the console.
+func virshConsole(mgr *vu.Manager, virsh, name string, force bool) error {
+	// report errors like a missing VM the same way as the other commands
+	_, err := mgr.VM.Get(name)
+	if err != nil {
+		return err
+	}
+	uri, err := vu.VirshURI(mgr.URI)
+	if err != nil {
+		return err
+	}
+	args := []string{"-c", uri, "console", name}
+	if force {
+		args = append(args, "--force")
+	}
+	virshCmd := exec.Command(virsh, args...)
+	virshCmd.Stdin = os.Stdin
+	virshCmd.Stdout = os.Stdout
+	virshCmd.Stderr = os.Stderr
+	return virshCmd.Run()
+}
+
+// waitForKey reads from r until the key is read or r is closed.
+func waitForKey(r io.Reader, key byte) {
+	buf := make([]byte, 64)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			if b == key {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	vu "github.com/dvob/vu/internal"
+	"github.com/dvob/vu/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// applyContext loads the context and uses its values as defaults for all
+// flags which were not set explicitly on the command line.
+func applyContext(cmd *cobra.Command, name string, opts *vu.LibvirtOptions) error {
+	_, cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		name = os.Getenv(envVarPrefix + "CONTEXT")
+	}
+	if name == "" {
+		name = cfg.CurrentContext
+	}
+	if name == "" {
+		return nil
+	}
+
+	ctx, err := cfg.Context(name)
+	if err != nil {
+		return err
+	}
+	opts.Context = name
+
+	defaults := map[string]string{
+		"uri":                 ctx.URI,
+		"image-base-dir":      ctx.ImageBaseDir,
+		"network":             ctx.Network,
+		"profile":             strings.Join(ctx.Profiles, ","),
+		"address-source":      strings.Join(ctx.AddressSources, ","),
+		"preferred-interface": ctx.PreferredInterface,
+		"preferred-subnet":    ctx.PreferredSubnet,
+	}
+	if ctx.Pools != nil {
+		if ctx.Pools.Config != nil {
+			defaults["config-pool"] = ctx.Pools.Config.Name
+		}
+		if ctx.Pools.Base != nil {
+			defaults["base-pool"] = ctx.Pools.Base.Name
+		}
+		if ctx.Pools.VM != nil {
+			defaults["vm-pool"] = ctx.Pools.VM.Name
+		}
+		opts.Pools = append(opts.Pools, ctx.Pools.List()...)
+	}
+
+	err = setFlagDefaults(cmd.Root().Flags(), defaults)
+	if err != nil {
+		return err
+	}
+	return setFlagDefaults(cmd.Flags(), defaults)
+}
+
+func setFlagDefaults(flags *pflag.FlagSet, defaults map[string]string) error {
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		val := defaults[f.Name]
+		if val == "" || f.Changed {
+			return
+		}
+		innerErr := f.Value.Set(val)
+		if innerErr != nil {
+			err = fmt.Errorf("invalid value for %s in context: %w", f.Name, innerErr)
+		}
+	})
+	return err
+}
+
+func newContextCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "context",
+		Short: "manage contexts to access different hypervisor hosts",
+		Long: `Contexts are configured in ~/.config/vu/config.yaml. Each context
+bundles the libvirt URI, the image base directory, the storage pool names, the
+default network and the default profiles of a hypervisor host.`,
+	}
+	cmd.AddCommand(
+		newContextListCmd(),
+		newContextCurrentCmd(),
+		newContextUseCmd(),
+	)
+	return cmd
+}
+
+func newContextListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "list",
+		Short:       "list contexts",
+		Aliases:     []string{"ls"},
+		Annotations: map[string]string{noConnectAnnotation: "", noContextAnnotation: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			w := &tabwriter.Writer{}
+			w.Init(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintf(w, "CURRENT\tNAME\tURI\n")
+			for _, ctx := range cfg.Contexts {
+				current := ""
+				if ctx.Name == cfg.CurrentContext {
+					current = "*"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", current, ctx.Name, ctx.URI)
+			}
+			w.Flush()
+			return nil
+		},
+	}
+	return cmd
+}
+
+func newContextCurrentCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "current",
+		Short:       "show the current context",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{noConnectAnnotation: "", noContextAnnotation: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if cfg.CurrentContext == "" {
+				return fmt.Errorf("current context is not set")
+			}
+			fmt.Println(cfg.CurrentContext)
+			return nil
+		},
+	}
+	return cmd
+}
+
+func newContextUseCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "use NAME",
+		Short:       "set the current context",
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{noConnectAnnotation: "", noContextAnnotation: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			err = cfg.Use(args[0])
+			if err != nil {
+				return err
+			}
+			return cfg.Save(file)
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			_, cfg, err := loadConfig()
+			if err != nil {
+				cobra.CompErrorln(err.Error())
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			names := []string{}
+			for _, ctx := range cfg.Contexts {
+				names = append(names, ctx.Name)
+			}
+			return names, cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	return cmd
+}
+
+func loadConfig() (string, *config.Config, error) {
+	file, err := config.DefaultFile()
+	if err != nil {
+		return "", nil, err
+	}
+	cfg, err := config.Load(file)
+	return file, cfg, err
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"code.cloudfoundry.org/bytefmt"
+	vu "github.com/dvob/vu/internal"
+	"github.com/spf13/cobra"
+)
+
+// parseDataDisk parses the value of the --data-disk flag. The value is the
+// size of the disk optionally followed by a comma separated list of key=value
+// pairs (e.g. 20G,pool=data,bus=scsi).
+func parseDataDisk(value string) (*vu.DiskOptions, error) {
+	fields := strings.Split(value, ",")
+	size, err := bytefmt.ToBytes(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid size of data disk '%s': %w", fields[0], err)
+	}
+	disk := &vu.DiskOptions{
+		Size: size,
+	}
+	for _, field := range fields[1:] {
+		key, val, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid data disk option '%s': expected key=value", field)
+		}
+		switch key {
+		case "pool":
+			disk.Pool = val
+		case "bus":
+			disk.Bus = val
+		default:
+			return nil, fmt.Errorf("unknown data disk option '%s'", key)
+		}
+	}
+	return disk, nil
+}
+
+func newDiskCmd(mgr *vu.Manager) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "disk",
+		Short: "manage the data disks of VMs",
+	}
+	cmd.AddCommand(
+		newDiskAttachCmd(mgr),
+		newDiskDetachCmd(mgr),
+		newDiskListCmd(mgr),
+	)
+	return cmd
+}
+
+func newDiskAttachCmd(mgr *vu.Manager) *cobra.Command {
+	opts := vu.DiskOptions{}
+	cmd := &cobra.Command{
+		Use:   "attach NAME SIZE",
+		Short: "create a new data disk and attach it to a VM",
+		Long: `Creates a new data disk and attaches it to a VM. If the VM is running
+the disk is attached to the running VM as well.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			size, err := bytefmt.ToBytes(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid size '%s': %w", args[1], err)
+			}
+			opts.Size = size
+			disk, err := mgr.AttachDisk(args[0], opts)
+			if err != nil {
+				return err
+			}
+			fmt.Println(disk.Target)
+			return nil
+		},
+		ValidArgsFunction: completeVMFunc(mgr),
+	}
+	cmd.Flags().StringVar(&opts.Pool, "pool", "", "pool of the disk image (default VM image pool)")
+	cmd.Flags().StringVar(&opts.Bus, "bus", "virtio", "bus of the disk (virtio or scsi)")
+	return cmd
+}
+
+func newDiskDetachCmd(mgr *vu.Manager) *cobra.Command {
+	var keep bool
+	cmd := &cobra.Command{
+		Use:   "detach NAME TARGET",
+		Short: "detach a data disk from a VM and remove it",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := mgr.DetachDisk(args[0], args[1], keep)
+			return err
+		},
+		ValidArgsFunction: completeVMFunc(mgr),
+	}
+	cmd.Flags().BoolVar(&keep, "keep", false, "keep the image of the disk")
+	return cmd
+}
+
+func newDiskListCmd(mgr *vu.Manager) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list NAME",
+		Short:   "list the disks of a VM",
+		Aliases: []string{"ls"},
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, err := mgr.VM.Get(args[0])
+			if err != nil {
+				return err
+			}
+
+			w := &tabwriter.Writer{}
+			w.Init(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintf(w, "TARGET\tBUS\tIMAGE\n")
+			for _, disk := range state.Disks {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", disk.Target, disk.Bus, disk.Image)
+			}
+			w.Flush()
+			return nil
+		},
+		ValidArgsFunction: completeVMFunc(mgr),
+	}
+	return cmd
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	vu "github.com/dvob/vu/internal"
+	"github.com/dvob/vu/internal/sshconfig"
+	"github.com/spf13/cobra"
+)
+
+func newDoctorCmd(opts *vu.LibvirtOptions) *cobra.Command {
+	var (
+		network string
+		output  string
+	)
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "check the environment for problems",
+		Long: `Checks the connection to libvirtd, KVM, the network, the storage pools, the
+available disk space, the SSH key and the name resolution of the VMs (SSH
+config include or libvirt NSS module). For each failed
+check a hint on how to fix the problem is shown.`,
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{noConnectAnnotation: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			checks := vu.Diagnose(opts, network)
+			checks = append(checks, checkSSHKey(), checkNameResolution())
+
+			failed := 0
+			for _, check := range checks {
+				if !check.OK {
+					failed++
+				}
+			}
+
+			switch output {
+			case "json":
+				raw, err := json.MarshalIndent(checks, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(raw))
+			case "text":
+				for _, check := range checks {
+					status := "OK"
+					if !check.OK {
+						status = "FAIL"
+					}
+					fmt.Printf("[%-4s] %s: %s\n", status, check.Name, check.Message)
+					if !check.OK && check.Hint != "" {
+						fmt.Printf("       hint: %s\n", check.Hint)
+					}
+				}
+			default:
+				return fmt.Errorf("unknown output format '%s'", output)
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&network, "network", "default", "name of the network to check")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "output format (text, json)")
+	return cmd
+}
+
+// checkSSHKey checks the SSH public key which is used by default.
+func checkSSHKey() vu.Check {
+	check := vu.Check{
+		Name: "ssh key",
+	}
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	keyFile := filepath.Join(userHome, ".ssh", "id_rsa.pub")
+	_, err = os.Stat(keyFile)
+	if err != nil {
+		check.Message = err.Error()
+		check.Hint = "create a key with ssh-keygen or pass a key with --ssh-pub-key"
+		return check
+	}
+	check.OK = true
+	check.Message = keyFile
+	return check
+}
+
+// checkNameResolution checks if the names of the VMs can be resolved either
+// with the SSH config of vu or with the libvirt NSS module.
+func checkNameResolution() vu.Check {
+	check := vu.Check{
+		Name: "name resolution",
+	}
+
+	file, err := sshconfig.DefaultFile()
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	userConfig, err := userSSHConfig()
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	included, err := sshconfig.Included(userConfig, file)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	if included {
+		check.OK = true
+		check.Message = file + " included in " + userConfig
+		return check
+	}
+
+	check = checkNSS()
+	if !check.OK {
+		check.Hint = fmt.Sprintf("add 'Include %s' at the top of %s or %s", file, userConfig, check.Hint)
+	}
+	return check
+}
+
+// checkNSS checks if the libvirt NSS module is configured to resolve the
+// names of the VMs.
+func checkNSS() vu.Check {
+	check := vu.Check{
+		Name: "name resolution",
+	}
+	file, err := os.Open("/etc/nsswitch.conf")
+	if err != nil {
+		check.Message = err.Error()
+		check.Hint = "connect to the VMs by IP"
+		return check
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "hosts:" {
+			continue
+		}
+		for _, source := range fields[1:] {
+			if source == "libvirt" || source == "libvirt_guest" {
+				check.OK = true
+				check.Message = "libvirt configured in /etc/nsswitch.conf"
+				return check
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	check.Message = "libvirt not configured in /etc/nsswitch.conf"
+	check.Hint = "install libnss-libvirt and add libvirt to the hosts line in /etc/nsswitch.conf"
+	return check
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	vu "github.com/dvob/vu/internal"
+	"github.com/dvob/vu/internal/forward"
+	"github.com/spf13/cobra"
+)
+
+func newForwardCmd(mgr *vu.Manager) *cobra.Command {
+	var (
+		address    string
+		detach     bool
+		background bool
+	)
+	cmd := &cobra.Command{
+		Use:   "forward NAME PORT...",
+		Short: "forward ports from the host to a VM",
+		Long: `Forwards TCP ports from the host to a VM as long as the command runs. A port
+is either specified as HOST_PORT:GUEST_PORT or as PORT if both ports are the
+same. With --detach the forwarding runs in the background until it is stopped
+with vu forward stop.`,
+		Example: `  # forward port 8080 on the host to port 80 of the VM
+  vu forward mytest1 8080:80
+
+  # forward in the background
+  vu forward --detach mytest1 8080:80 8443:443`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			ports := []forward.Port{}
+			for _, arg := range args[1:] {
+				port, err := forward.ParsePort(arg)
+				if err != nil {
+					return err
+				}
+				ports = append(ports, port)
+			}
+
+			dir, err := forward.DefaultDir()
+			if err != nil {
+				return err
+			}
+
+			// the address is resolved again if the VM gets another
+			// address while the forwarding runs
+			resolve := func() (string, error) {
+				v, err := mgr.VM.Get(name)
+				if err != nil {
+					return "", err
+				}
+				if v.IPAddress == "" || v.IPAddress == "n/a" {
+					return "", fmt.Errorf("vm '%s' has no IP address yet", name)
+				}
+				return v.IPAddress, nil
+			}
+			guestIP, err := resolve()
+			if err != nil {
+				return err
+			}
+
+			if detach && !background {
+				return startDetached(dir, name, ports)
+			}
+
+			listeners, err := forward.Listen(address, ports)
+			if err != nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			// the state is only recorded for forwardings in the background
+			if background {
+				state := &forward.State{
+					PID:     os.Getpid(),
+					URI:     mgr.URI,
+					VM:      name,
+					Address: address,
+					GuestIP: guestIP,
+					Ports:   ports,
+				}
+				err = state.Save(dir)
+				if err != nil {
+					return err
+				}
+				defer func() { _ = state.Remove(dir) }()
+			}
+
+			for _, port := range ports {
+				fmt.Printf("forwarding %s to %s:%d\n", listenAddress(address, port.Host), guestIP, port.Guest)
+			}
+			return forward.Serve(ctx, listeners, forward.NewGuest(guestIP, resolve), ports)
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return completeVMFunc(mgr)(cmd, args, toComplete)
+		},
+	}
+	cmd.Flags().StringVar(&address, "address", "", "address on the host to listen on (default all addresses)")
+	cmd.Flags().BoolVarP(&detach, "detach", "d", false, "run the forwarding in the background")
+	cmd.Flags().BoolVar(&background, "background", false, "marks the process which runs in the background")
+	_ = cmd.Flags().MarkHidden("background")
+	// the process in the background is only started by --detach
+	_ = cmd.Flags().SetAnnotation("detach", noEnvAnnotation, nil)
+	_ = cmd.Flags().SetAnnotation("background", noEnvAnnotation, nil)
+	cmd.AddCommand(
+		newForwardListCmd(),
+		newForwardStopCmd(),
+	)
+	return cmd
+}
+
+// startDetached starts the same command again with the hidden flag
+// --background and waits until the forwarding is ready.
+func startDetached(dir, name string, ports []forward.Port) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+	logFile := filepath.Join(dir, forward.Name(name, ports)+".log")
+	log, err := os.Create(logFile)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	args := append(os.Args[1:], "--background")
+	c := exec.Command(exe, args...)
+	c.Stdout = log
+	c.Stderr = log
+	c.SysProcAttr = forward.DetachAttr()
+	err = c.Start()
+	if err != nil {
+		return err
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		_ = c.Wait()
+		close(exited)
+	}()
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case <-exited:
+			return fmt.Errorf("forwarding failed, see %s", logFile)
+		case <-timeout:
+			return fmt.Errorf("forwarding did not start in time, see %s", logFile)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		states, err := forward.List(dir)
+		if err != nil {
+			return err
+		}
+		for _, s := range states {
+			if s.PID == c.Process.Pid {
+				fmt.Printf("forwarding ports of vm '%s' in the background (pid %d)\n", name, s.PID)
+				return nil
+			}
+		}
+	}
+}
+
+func listenAddress(address string, port int) string {
+	return displayAddress(address) + ":" + strconv.Itoa(port)
+}
+
+// displayAddress returns * for all addresses.
+func displayAddress(address string) string {
+	if address == "" {
+		return "*"
+	}
+	return address
+}
+
+func newForwardListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "list",
+		Short:       "list forwardings which run in the background",
+		Aliases:     []string{"ls"},
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{noConnectAnnotation: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := forward.DefaultDir()
+			if err != nil {
+				return err
+			}
+			states, err := forward.List(dir)
+			if err != nil {
+				return err
+			}
+
+			w := &tabwriter.Writer{}
+			w.Init(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintf(w, "VM\tADDRESS\tPORTS\tGUEST IP\tPID\n")
+			for _, s := range states {
+				ports := []string{}
+				for _, port := range s.Ports {
+					ports = append(ports, port.String())
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", s.VM, displayAddress(s.Address), strings.Join(ports, ","), s.GuestIP, s.PID)
+			}
+			w.Flush()
+			return nil
+		},
+	}
+	return cmd
+}
+
+func newForwardStopCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "stop NAME [HOST_PORT]",
+		Short:       "stop forwardings which run in the background",
+		Long:        "Stops all forwardings of a VM which run in the background or only the forwarding of a host port.",
+		Args:        cobra.RangeArgs(1, 2),
+		Annotations: map[string]string{noConnectAnnotation: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			hostPort := 0
+			if len(args) > 1 {
+				port, err := forward.ParsePort(args[1])
+				if err != nil {
+					return err
+				}
+				hostPort = port.Host
+			}
+
+			dir, err := forward.DefaultDir()
+			if err != nil {
+				return err
+			}
+			states, err := forward.List(dir)
+			if err != nil {
+				return err
+			}
+			stopped := 0
+			for _, s := range states {
+				if s.VM != name || (hostPort != 0 && !hasHostPort(s.Ports, hostPort)) {
+					continue
+				}
+				err := s.Stop(dir)
+				if err != nil {
+					return err
+				}
+				stopped++
+			}
+			if stopped == 0 {
+				return fmt.Errorf("no forwarding of vm '%s' found", name)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func hasHostPort(ports []forward.Port, hostPort int) bool {
+	for _, port := range ports {
+		if port.Host == hostPort {
+			return true
+		}
+	}
+	return false
+}
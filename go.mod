@@ -13,7 +13,9 @@ require (
 	github.com/mattn/go-runewidth v0.0.14 // indirect
 	github.com/spf13/cobra v1.6.1
 	github.com/spf13/pflag v1.0.5
-	golang.org/x/sys v0.4.0 // indirect
+	golang.org/x/crypto v0.17.0
+	golang.org/x/sys v0.15.0 // indirect
+	golang.org/x/term v0.15.0
 	gopkg.in/cheggaaa/pb.v1 v1.0.28
 )
 
@@ -20,7 +20,7 @@ func newImageCmd(mgr *vu.Manager) *cobra.Command {
 		newImageAddCmd(mgr, &pool),
 		newImageRemoveCmd(mgr, &pool),
 	)
-	cmd.PersistentFlags().StringVar(&pool, "pool", "base", "Image pool")
+	cmd.PersistentFlags().StringVar(&pool, "pool", "", "Image pool (default base image pool)")
 	return cmd
 }
 
@@ -40,7 +40,7 @@ file scheme. If no name is given the name is derived from the URL.`,
 			if len(args) > 1 {
 				name = args[1]
 			}
-			_, err := image.AddFromURL(mgr.Image, *pool, name, url, os.Stdout)
+			_, err := image.AddFromURL(mgr.Image, imagePool(mgr, *pool), name, url, os.Stdout)
 			return err
 		},
 	}
@@ -53,7 +53,7 @@ func newImageListCmd(mgr *vu.Manager, pool *string) *cobra.Command {
 		Short:   "list images",
 		Aliases: []string{"ls"},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			images, err := mgr.Image.List(*pool)
+			images, err := mgr.Image.List(imagePool(mgr, *pool))
 			if err != nil {
 				return err
 			}
@@ -78,11 +78,7 @@ func newImageRemoveCmd(mgr *vu.Manager, pool *string) *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			names = args
 			for _, name := range names {
-				img, err := mgr.Image.Get(*pool, name)
-				if err != nil {
-					return err
-				}
-				err = mgr.Image.Remove(img.ID)
+				err := mgr.RemoveImage(imagePool(mgr, *pool), name)
 				if err != nil {
 					errs = append(errs, err)
 				}
@@ -102,7 +98,7 @@ func completeBaseImageFunc(mgr *vu.Manager, pool *string, max int) func(cmd *cob
 		if max != 0 && len(args) >= max {
 			return nil, cobra.ShellCompDirectiveNoFileComp
 		}
-		images, err := mgr.Image.List(*pool)
+		images, err := mgr.Image.List(imagePool(mgr, *pool))
 		if err != nil {
 			cobra.CompErrorln(err.Error())
 			return nil, cobra.ShellCompDirectiveNoFileComp
@@ -117,3 +113,12 @@ func completeBaseImageFunc(mgr *vu.Manager, pool *string, max int) func(cmd *cob
 		return imageNames, cobra.ShellCompDirectiveNoFileComp
 	}
 }
+
+// imagePool returns pool or the base image pool of the manager if pool is
+// empty.
+func imagePool(mgr *vu.Manager, pool string) string {
+	if pool == "" {
+		return mgr.BaseImagePool
+	}
+	return pool
+}
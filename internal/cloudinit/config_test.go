@@ -119,3 +119,15 @@ func Test_MergeConfig(t *testing.T) {
 	is.NoErr(err) // failed to render c1Output
 	is.Equal(expectedOutput, c1Output)
 }
+
+func Test_UserData_EnableResize(t *testing.T) {
+	is := is.New(t)
+
+	ud := &UserData{}
+	err := ud.Unmarshal([]byte("#cloud-config\nresize_rootfs: false\n"))
+	is.NoErr(err)
+
+	ud.EnableResize()
+	is.Equal(ud.GrowPart.Mode, "auto") // growpart enabled
+	is.Equal(*ud.ResizeRootFS, false)  // existing configuration is kept
+}
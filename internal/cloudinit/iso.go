@@ -31,7 +31,9 @@ func (c *Config) ISO() ([]byte, error) {
 
 	if c.NetworkConfig != nil {
 		err = marshalToIso(iw, networkFileName, c.NetworkConfig)
-		return nil, err
+		if err != nil {
+			return nil, err
+		}
 	}
 	isoImage := &bytes.Buffer{}
 	err = iw.WriteTo(isoImage, "cidata")
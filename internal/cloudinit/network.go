@@ -1,6 +1,7 @@
 package cloudinit
 
 import (
+	"fmt"
 	"net"
 )
 
@@ -14,8 +15,18 @@ type Ethernet struct {
 	Match     *Match   `json:"match,omitempty"`
 	Addresses []string `json:"addresses,omitempty"`
 	DHCP      *bool    `json:"dhcp4,omitempty"`
-	Gateway   *string  `json:"gateway4,omitempty"`
-	DNS       *DNS     `json:"nameservers,omitempty"`
+	DHCP6     *bool    `json:"dhcp6,omitempty"`
+	AcceptRA  *bool    `json:"accept-ra,omitempty"`
+	// Gateway is deprecated in favor of Routes. It is only here to read
+	// existing configurations.
+	Gateway *string `json:"gateway4,omitempty"`
+	Routes  []Route `json:"routes,omitempty"`
+	DNS     *DNS    `json:"nameservers,omitempty"`
+}
+
+type Route struct {
+	To  string `json:"to"`
+	Via string `json:"via"`
 }
 
 type Match struct {
@@ -40,71 +51,174 @@ func (nc *NetworkConfig) Merge(nc2 *NetworkConfig) error {
 	return merge(nc, nc2)
 }
 
+// NetworkConfigOptions describes the configuration of a network interface.
+// If MAC is set the interface is matched by its MAC address. Addresses can be
+// IPv4 and IPv6 addresses in CIDR notation. An interface without an IPv4
+// address uses DHCP. For IPv6 DHCP6 and SLAAC (router advertisements) can be
+// enabled. Gateways can contain one gateway per address family.
 type NetworkConfigOptions struct {
-	Address    string
-	Gateway    string
+	MAC        string
+	Addresses  []string
+	Gateways   []string
 	Nameserver []string
+	DHCP6      bool
+	SLAAC      bool
+}
+
+// static returns true if the interface needs configuration beyond the default
+// DHCP configuration.
+func (nco *NetworkConfigOptions) static() bool {
+	return len(nco.Addresses) > 0 || nco.DHCP6 || nco.SLAAC
 }
 
-func NewNetworkConfig(nco NetworkConfigOptions) (*NetworkConfig, error) {
+// NewNetworkConfig returns a network configuration with one ethernet entry for
+// each interface. If only one interface with the default DHCP configuration
+// and without a MAC address is configured no network configuration is needed
+// and nil is returned. The default gateways are only derived from the
+// addresses of the first interface.
+func NewNetworkConfig(interfaces ...NetworkConfigOptions) (*NetworkConfig, error) {
+	if len(interfaces) == 0 || (len(interfaces) == 1 && !interfaces[0].static() && interfaces[0].MAC == "") {
+		return nil, nil
+	}
+
+	c := &NetworkConfig{
+		Version:   2,
+		Ethernets: map[string]Ethernet{},
+	}
+	for i, nco := range interfaces {
+		if len(interfaces) > 1 && nco.MAC == "" {
+			return nil, fmt.Errorf("MAC address required for interface %d since multiple interfaces are configured", i)
+		}
+
+		ethernet, err := newEthernet(nco, i == 0)
+		if err != nil {
+			return nil, err
+		}
+
+		name := "default"
+		if nco.MAC != "" {
+			name = fmt.Sprintf("nic%d", i)
+		}
+		c.Ethernets[name] = *ethernet
+	}
+	return c, nil
+}
+
+func newEthernet(nco NetworkConfigOptions, deriveGateways bool) (*Ethernet, error) {
 	var (
-		// will only work for one interface
+		// only used without MAC address and will only work for one
+		// interface
 		matchName  = "en*"
-		gateway    string
+		mac        = nco.MAC
+		enabled    = true
+		gateway4   net.IP
+		gateway6   net.IP
 		nameserver = []string{}
 	)
 
-	if nco.Address == "" {
-		return nil, nil
+	ethernet := &Ethernet{
+		Match: &Match{
+			Name: &matchName,
+		},
+	}
+	if mac != "" {
+		ethernet.Match = &Match{
+			MAC: &mac,
+		}
+	}
+
+	for _, gw := range nco.Gateways {
+		ip := net.ParseIP(gw)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid gateway '%s'", gw)
+		}
+		if ip.To4() != nil {
+			gateway4 = ip
+		} else {
+			gateway6 = ip
+		}
+	}
+
+	for _, address := range nco.Addresses {
+		ip, ipNet, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, err
+		}
+		if ip.To4() != nil {
+			if gateway4 == nil && deriveGateways {
+				gateway4 = getGatewayIP(ipNet)
+			}
+		} else {
+			if gateway6 == nil && deriveGateways {
+				gateway6 = getGatewayIP(ipNet)
+			}
+		}
+		ethernet.Addresses = append(ethernet.Addresses, address)
 	}
 
-	_, ipNet, err := net.ParseCIDR(nco.Address)
-	if err != nil {
-		return nil, err
+	if !hasIPv4(ethernet.Addresses) {
+		ethernet.DHCP = &enabled
+	}
+	if nco.DHCP6 {
+		ethernet.DHCP6 = &enabled
+	}
+	if nco.SLAAC {
+		ethernet.AcceptRA = &enabled
 	}
 
-	if nco.Gateway == "" {
-		gateway = getGatewayIP(ipNet).String()
-	} else {
-		gateway = nco.Gateway
+	if gateway4 != nil {
+		ethernet.Routes = append(ethernet.Routes, Route{
+			To:  "0.0.0.0/0",
+			Via: gateway4.String(),
+		})
+		nameserver = append(nameserver, gateway4.String())
+	}
+	if gateway6 != nil {
+		ethernet.Routes = append(ethernet.Routes, Route{
+			To:  "::/0",
+			Via: gateway6.String(),
+		})
+		nameserver = append(nameserver, gateway6.String())
 	}
 
-	if nco.Nameserver == nil || len(nco.Nameserver) == 0 {
-		nameserver = append(nameserver, gateway)
-	} else {
+	// without an explicit nameserver the gateways are used
+	if len(nco.Nameserver) > 0 {
 		nameserver = nco.Nameserver
 	}
+	if len(nameserver) > 0 {
+		ethernet.DNS = &DNS{
+			Servers: nameserver,
+		}
+	}
+	return ethernet, nil
+}
 
-	c := &NetworkConfig{
-		Version: 2,
-		Ethernets: map[string]Ethernet{
-			"default": {
-				Match: &Match{
-					Name: &matchName,
-				},
-				Addresses: []string{nco.Address},
-				Gateway:   &gateway,
-				DNS: &DNS{
-					Servers: nameserver,
-				},
-			},
-		},
+func hasIPv4(addresses []string) bool {
+	for _, address := range addresses {
+		ip, _, err := net.ParseCIDR(address)
+		if err == nil && ip.To4() != nil {
+			return true
+		}
 	}
-	return c, nil
+	return false
 }
 
+// getGatewayIP returns the first address of the network.
 func getGatewayIP(ipNet *net.IPNet) net.IP {
 	return incrementIP(ipNet.IP, 1)
 }
 
-// incrementIP increments an IP https://stackoverflow.com/a/49057611
+// incrementIP increments an IPv4 or IPv6 address.
 func incrementIP(ip net.IP, inc uint) net.IP {
-	i := ip.To4()
-	v := uint(i[0])<<24 + uint(i[1])<<16 + uint(i[2])<<8 + uint(i[3])
-	v += inc
-	v3 := byte(v & 0xFF)
-	v2 := byte((v >> 8) & 0xFF)
-	v1 := byte((v >> 16) & 0xFF)
-	v0 := byte((v >> 24) & 0xFF)
-	return net.IPv4(v0, v1, v2, v3)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	result := make(net.IP, len(ip))
+	carry := inc
+	for i := len(ip) - 1; i >= 0; i-- {
+		sum := uint(ip[i]) + carry
+		result[i] = byte(sum & 0xFF)
+		carry = sum >> 8
+	}
+	return result
 }
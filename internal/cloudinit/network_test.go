@@ -0,0 +1,97 @@
+package cloudinit
+
+import (
+	"net"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_NewNetworkConfig_MultipleInterfaces(t *testing.T) {
+	is := is.New(t)
+
+	nc, err := NewNetworkConfig(
+		NetworkConfigOptions{
+			MAC:       "52:54:00:00:00:01",
+			Addresses: []string{"192.168.1.10/24"},
+		},
+		NetworkConfigOptions{
+			MAC: "52:54:00:00:00:02",
+		},
+	)
+	is.NoErr(err)
+	is.Equal(len(nc.Ethernets), 2) // one ethernet per interface
+
+	nic0 := nc.Ethernets["nic0"]
+	is.Equal(*nic0.Match.MAC, "52:54:00:00:00:01") // first interface matched by MAC
+	is.Equal(nic0.Addresses, []string{"192.168.1.10/24"})
+	is.Equal(nic0.Routes, []Route{{To: "0.0.0.0/0", Via: "192.168.1.1"}}) // gateway derived from address
+	is.Equal(nic0.DNS.Servers, []string{"192.168.1.1"})                   // gateway used as nameserver
+
+	nic1 := nc.Ethernets["nic1"]
+	is.Equal(*nic1.Match.MAC, "52:54:00:00:00:02") // second interface matched by MAC
+	is.True(*nic1.DHCP)                            // second interface uses DHCP
+	is.Equal(len(nic1.Routes), 0)                  // gateway only derived for first interface
+
+	_, err = NewNetworkConfig(
+		NetworkConfigOptions{MAC: "52:54:00:00:00:01"},
+		NetworkConfigOptions{},
+	)
+	is.True(err != nil) // MAC required for multiple interfaces
+
+	nc, err = NewNetworkConfig(NetworkConfigOptions{})
+	is.NoErr(err)
+	is.Equal(nc, nil) // no config required for a single DHCP interface
+
+	nc, err = NewNetworkConfig(NetworkConfigOptions{MAC: "52:54:00:00:00:01"})
+	is.NoErr(err)
+	is.Equal(*nc.Ethernets["nic0"].Match.MAC, "52:54:00:00:00:01") // DHCP interface matched by MAC
+	is.Equal(*nc.Ethernets["nic0"].DHCP, true)
+}
+
+func Test_NewNetworkConfig_IPv6(t *testing.T) {
+	is := is.New(t)
+
+	// dual stack
+	nc, err := NewNetworkConfig(NetworkConfigOptions{
+		Addresses: []string{"192.168.1.10/24", "fd00:1::10/64"},
+	})
+	is.NoErr(err)
+	eth := nc.Ethernets["default"]
+	is.Equal(eth.DHCP, nil) // no DHCP with static IPv4 address
+	is.Equal(eth.Routes, []Route{
+		{To: "0.0.0.0/0", Via: "192.168.1.1"},
+		{To: "::/0", Via: "fd00:1::1"},
+	})
+	is.Equal(eth.DNS.Servers, []string{"192.168.1.1", "fd00:1::1"})
+
+	// DHCP for IPv4 and SLAAC for IPv6
+	nc, err = NewNetworkConfig(NetworkConfigOptions{
+		SLAAC: true,
+		DHCP6: true,
+	})
+	is.NoErr(err)
+	eth = nc.Ethernets["default"]
+	is.True(*eth.DHCP)
+	is.True(*eth.DHCP6)
+	is.True(*eth.AcceptRA)
+	is.Equal(eth.DNS, nil) // nameservers from DHCP
+
+	// explicit gateway
+	nc, err = NewNetworkConfig(NetworkConfigOptions{
+		Addresses: []string{"fd00:1::10/64"},
+		Gateways:  []string{"fd00:1::fe"},
+	})
+	is.NoErr(err)
+	eth = nc.Ethernets["default"]
+	is.True(*eth.DHCP) // DHCP for IPv4 without static IPv4 address
+	is.Equal(eth.Routes, []Route{{To: "::/0", Via: "fd00:1::fe"}})
+}
+
+func Test_incrementIP(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(incrementIP(net.ParseIP("10.0.0.255"), 1).String(), "10.0.1.0")
+	is.Equal(incrementIP(net.ParseIP("fd00::ffff"), 1).String(), "fd00::1:0")
+	is.Equal(incrementIP(net.ParseIP("fd00::"), 1).String(), "fd00::1")
+}
@@ -9,6 +9,24 @@ type UserData struct {
 	// Password        string `yaml:"password,omitempty"`
 	// SSHPasswordAuth bool   `yaml:"ssh_pwauth,omitempty"`
 	Users []User `json:"users,omitempty"`
+	// SSHKeys are the SSH host keys of the VM (e.g. ed25519_private and
+	// ed25519_public).
+	SSHKeys  map[string]string `json:"ssh_keys,omitempty"`
+	Packages []string          `json:"packages,omitempty"`
+	RunCmd   []any             `json:"runcmd,omitempty"`
+	// GrowPart and ResizeRootFS grow the root partition and file system
+	// on each boot if the disk got larger.
+	GrowPart     *GrowPart `json:"growpart,omitempty"`
+	ResizeRootFS *bool     `json:"resize_rootfs,omitempty"`
+	// Mounts are fstab entries (device, mount point, type, options, dump,
+	// pass).
+	Mounts [][]string `json:"mounts,omitempty"`
+}
+
+// GrowPart is the configuration of the cloud-init growpart module.
+type GrowPart struct {
+	Mode    string   `json:"mode"`
+	Devices []string `json:"devices"`
 }
 
 // User definition of cloud init configuration
@@ -21,6 +39,61 @@ type User struct {
 	Shell             string   `json:"shell"`
 }
 
+const (
+	guestAgentPackage = "qemu-guest-agent"
+	// the guest agent is started by udev when the channel appears, which
+	// already happened when the package gets installed on the first boot
+	guestAgentStart = "systemctl start qemu-guest-agent"
+)
+
+// EnableGuestAgent installs and starts the QEMU guest agent.
+func (ud *UserData) EnableGuestAgent() {
+	if !containsString(ud.Packages, guestAgentPackage) {
+		ud.Packages = append(ud.Packages, guestAgentPackage)
+	}
+	for _, cmd := range ud.RunCmd {
+		if cmd == guestAgentStart {
+			return
+		}
+	}
+	ud.RunCmd = append(ud.RunCmd, guestAgentStart)
+}
+
+// EnableResize enables the growpart and resize_rootfs modules of cloud-init
+// unless they are configured already.
+func (ud *UserData) EnableResize() {
+	if ud.GrowPart == nil {
+		ud.GrowPart = &GrowPart{
+			Mode:    "auto",
+			Devices: []string{"/"},
+		}
+	}
+	if ud.ResizeRootFS == nil {
+		enabled := true
+		ud.ResizeRootFS = &enabled
+	}
+}
+
+// AddMount adds a mount unless a mount with the same mount point exists
+// already.
+func (ud *UserData) AddMount(device, mountPoint, fsType, options string) {
+	for _, mount := range ud.Mounts {
+		if len(mount) > 1 && mount[1] == mountPoint {
+			return
+		}
+	}
+	ud.Mounts = append(ud.Mounts, []string{device, mountPoint, fsType, options, "0", "0"})
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
 func (ud *UserData) Marshal() ([]byte, error) {
 	data, err := mergeMarshal(ud, ud.Raw)
 	if err != nil {
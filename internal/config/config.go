@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	image "github.com/dvob/vu/internal/image/libvirt"
+	"github.com/ghodss/yaml"
+)
+
+// Config is the configuration of vu. It is usually read from
+// ~/.config/vu/config.yaml and contains named contexts which describe how to
+// access different hypervisor hosts.
+type Config struct {
+	CurrentContext string     `json:"current-context,omitempty"`
+	Contexts       []Context  `json:"contexts,omitempty"`
+	Templates      []Template `json:"templates,omitempty"`
+}
+
+// Context bundles all settings which are specific to a hypervisor host.
+// Empty values are not applied and the defaults or the command line flags
+// are used instead.
+type Context struct {
+	Name         string   `json:"name"`
+	URI          string   `json:"uri,omitempty"`
+	ImageBaseDir string   `json:"image-base-dir,omitempty"`
+	Pools        *Pools   `json:"pools,omitempty"`
+	Network      string   `json:"network,omitempty"`
+	Profiles     []string `json:"profiles,omitempty"`
+	// AddressSources, PreferredInterface and PreferredSubnet define how
+	// the IP addresses of the VMs are determined.
+	AddressSources     []string `json:"address-sources,omitempty"`
+	PreferredInterface string   `json:"preferred-interface,omitempty"`
+	PreferredSubnet    string   `json:"preferred-subnet,omitempty"`
+}
+
+// Template bundles the options to create a VM (e.g. an instance type). Empty
+// values are not applied. The values have the format of the corresponding
+// flags of vu create.
+type Template struct {
+	Name     string   `json:"name"`
+	Image    string   `json:"image,omitempty"`
+	Profiles []string `json:"profiles,omitempty"`
+	CPU      uint     `json:"cpu,omitempty"`
+	Memory   string   `json:"memory,omitempty"`
+	DiskSize string   `json:"disk-size,omitempty"`
+	// DataDisks are additional disks (e.g. 20G,bus=scsi).
+	DataDisks []string `json:"data-disks,omitempty"`
+	CPUMode   string   `json:"cpu-mode,omitempty"`
+	Firmware  string   `json:"firmware,omitempty"`
+	Machine   string   `json:"machine,omitempty"`
+	Arch      string   `json:"arch,omitempty"`
+	Network   string   `json:"network,omitempty"`
+	// NICs are network interfaces (e.g. network=lab,ip=auto).
+	NICs []string `json:"nics,omitempty"`
+}
+
+// Flags returns the values of the template by flag name. Flags which can be
+// repeated have multiple values.
+func (t *Template) Flags() map[string][]string {
+	flags := map[string][]string{}
+	set := func(name string, values ...string) {
+		if len(values) == 0 || values[0] == "" {
+			return
+		}
+		flags[name] = values
+	}
+	set("image", t.Image)
+	set("profile", t.Profiles...)
+	if t.CPU != 0 {
+		set("cpu", strconv.FormatUint(uint64(t.CPU), 10))
+	}
+	set("memory", t.Memory)
+	set("disk-size", t.DiskSize)
+	set("data-disk", t.DataDisks...)
+	set("cpu-mode", t.CPUMode)
+	set("firmware", t.Firmware)
+	set("machine", t.Machine)
+	set("arch", t.Arch)
+	set("network", t.Network)
+	set("nic", t.NICs...)
+	return flags
+}
+
+// Pools maps the roles of the storage pools vu uses for its images to pools.
+// A pool can either refer to an existing pool of any type by name or describe
+// a pool which vu creates if it does not exist yet.
+type Pools struct {
+	Config *image.PoolConfig `json:"config,omitempty"`
+	Base   *image.PoolConfig `json:"base,omitempty"`
+	VM     *image.PoolConfig `json:"vm,omitempty"`
+}
+
+// List returns all configured pools.
+func (p *Pools) List() []image.PoolConfig {
+	pools := []image.PoolConfig{}
+	for _, pool := range []*image.PoolConfig{p.Config, p.Base, p.VM} {
+		if pool != nil {
+			pools = append(pools, *pool)
+		}
+	}
+	return pools
+}
+
+// DefaultFile returns the location of the default configuration file.
+func DefaultFile() (string, error) {
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve config file: %w", err)
+	}
+	return filepath.Join(userHome, ".config", "vu", "config.yaml"), nil
+}
+
+// Load reads the configuration from file. If the file does not exist an empty
+// configuration is returned.
+func Load(file string) (*Config, error) {
+	c := &Config{}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(data, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", file, err)
+	}
+	return c, nil
+}
+
+// Save writes the configuration to file.
+func (c *Config) Save(file string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(file), 0o750)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0o640)
+}
+
+// Context returns the context with the given name.
+func (c *Config) Context(name string) (*Context, error) {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			return &c.Contexts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("context '%s' not found", name)
+}
+
+// Template returns the template with the given name.
+func (c *Config) Template(name string) (*Template, error) {
+	for i := range c.Templates {
+		if c.Templates[i].Name == name {
+			return &c.Templates[i], nil
+		}
+	}
+	return nil, fmt.Errorf("template '%s' not found", name)
+}
+
+// Use sets the current context. It fails if the context does not exist.
+func (c *Config) Use(name string) error {
+	_, err := c.Context(name)
+	if err != nil {
+		return err
+	}
+	c.CurrentContext = name
+	return nil
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_Template_Flags(t *testing.T) {
+	is := is.New(t)
+
+	tmpl := &Template{
+		Name:     "dev",
+		Profiles: []string{"dev", "docker"},
+		CPU:      2,
+		Memory:   "4G",
+		NICs:     []string{"network=lab", "network=wan"},
+	}
+	is.Equal(tmpl.Flags(), map[string][]string{
+		"profile": {"dev", "docker"},
+		"cpu":     {"2"},
+		"memory":  {"4G"},
+		"nic":     {"network=lab", "network=wan"},
+	}) // empty values are not set
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dvob/vu/internal/image"
+	"github.com/dvob/vu/internal/vm"
+)
+
+// DiskOptions describes an additional data disk of a VM. If Pool is empty the
+// disk is created in the VM image pool. If Bus is empty virtio is used.
+type DiskOptions struct {
+	Size uint64
+	Pool string
+	Bus  string
+}
+
+// createDisk creates an empty image for a data disk of the VM. The images are
+// named after the VM with the suffix _dataN, where N is the first number which
+// is not used yet in the pool. The names of VMs can not contain _, so the
+// images do not collide with the images of other VMs.
+func (m *Manager) createDisk(vmName string, opts DiskOptions) (*vm.Disk, error) {
+	if opts.Size == 0 {
+		return nil, fmt.Errorf("size of data disk required")
+	}
+	switch opts.Bus {
+	case "":
+		opts.Bus = vm.DiskBusVirtIO
+	case vm.DiskBusVirtIO, vm.DiskBusSCSI:
+	default:
+		return nil, fmt.Errorf("invalid disk bus '%s': use %s or %s", opts.Bus, vm.DiskBusVirtIO, vm.DiskBusSCSI)
+	}
+	pool := opts.Pool
+	if pool == "" {
+		pool = m.VMImagePool
+	}
+
+	for i := 1; ; i++ {
+		img, err := m.Image.CreateEmpty(pool, fmt.Sprintf("%s_data%d", vmName, i), opts.Size)
+		if errors.Is(err, image.ErrAlreadyExists) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create data disk: %w", err)
+		}
+		return &vm.Disk{
+			Image: img.ID,
+			Bus:   opts.Bus,
+		}, nil
+	}
+}
+
+// AttachDisk creates a new data disk and attaches it to the VM.
+func (m *Manager) AttachDisk(vmName string, opts DiskOptions) (*vm.Disk, error) {
+	_, err := m.VM.Get(vmName)
+	if err != nil {
+		return nil, err
+	}
+	disk, err := m.createDisk(vmName, opts)
+	if err != nil {
+		return nil, err
+	}
+	attached, err := m.VM.AttachDisk(vmName, *disk)
+	if err != nil {
+		_ = m.Image.Remove(disk.Image)
+		return nil, err
+	}
+	return attached, nil
+}
+
+// DetachDisk detaches the disk with the target device from the VM. Unless
+// keep is set, the image of the disk is removed. The image is kept if the
+// running VM did not release the disk.
+func (m *Manager) DetachDisk(vmName, target string, keep bool) (*vm.Disk, error) {
+	state, err := m.VM.Get(vmName)
+	if err != nil {
+		return nil, err
+	}
+	if len(state.Disks) > 0 && state.Disks[0].Target == target {
+		return nil, fmt.Errorf("disk '%s' is the boot disk of vm '%s' and can not be detached", target, vmName)
+	}
+	disk, err := m.VM.DetachDisk(vmName, target)
+	if err != nil && disk != nil && !keep {
+		return nil, fmt.Errorf("%w: the image '%s' is kept", err, disk.Image)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if keep || disk.Image == "" {
+		return disk, nil
+	}
+	err = m.Image.Remove(disk.Image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove image of disk '%s': %w", target, err)
+	}
+	return disk, nil
+}
@@ -0,0 +1,13 @@
+package internal
+
+import "syscall"
+
+// diskFree returns the available space of the file system of path.
+func diskFree(path string) (uint64, error) {
+	stat := &syscall.Statfs_t{}
+	err := syscall.Statfs(path, stat)
+	if err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package internal
+
+import "errors"
+
+// diskFree returns the available space of the file system of path.
+func diskFree(path string) (uint64, error) {
+	return 0, errors.New("not supported on this platform")
+}
@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/bytefmt"
+	"github.com/digitalocean/go-libvirt"
+	image "github.com/dvob/vu/internal/image/libvirt"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// minLibvirtVersion is the oldest version of libvirt vu is tested with.
+const minLibvirtVersion = 6_000_000
+
+// minAvailableSpace is the space which should at least be available in a
+// storage pool.
+const minAvailableSpace = 5 * bytefmt.GIGABYTE
+
+// Check is the result of a diagnostic check. If a check fails the hint
+// describes how to fix the problem.
+type Check struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// Diagnose checks the libvirt environment. If the connection to libvirtd
+// fails, the remaining checks are skipped.
+func Diagnose(o *LibvirtOptions, network string) []Check {
+	conn, err := connectLibvirt(o.URI)
+	if err != nil {
+		return []Check{
+			{
+				Name:    "libvirt connection",
+				Message: err.Error(),
+				Hint:    "check that libvirtd is running and that your user is allowed to access it (e.g. sudo adduser $USER libvirt)",
+			},
+		}
+	}
+	defer func() {
+		_ = conn.Disconnect()
+	}()
+
+	checks := []Check{
+		{
+			Name:    "libvirt connection",
+			OK:      true,
+			Message: "connected to " + o.URI,
+		},
+		checkVersion(conn),
+		checkKVM(conn),
+		checkNetwork(conn, network),
+	}
+
+	mgr := newLibvirtManager(o, conn)
+	checks = append(checks, mgr.CheckPools()...)
+	checks = append(checks, checkBaseDir(o))
+	return checks
+}
+
+// checkBaseDir checks the available space in the image base directory. This
+// is only possible if libvirtd runs on the local host.
+func checkBaseDir(o *LibvirtOptions) Check {
+	check := Check{
+		Name: "image base dir",
+		OK:   true,
+	}
+	if !strings.HasPrefix(o.URI, "unix:") {
+		check.Message = "skipped since libvirtd does not run locally"
+		return check
+	}
+
+	// the directory gets created with the first pool
+	path := o.BaseImageDir
+	if _, err := os.Stat(path); err != nil {
+		path = filepath.Dir(path)
+	}
+
+	available, err := diskFree(path)
+	if err != nil {
+		check.Message = fmt.Sprintf("skipped: %s", err)
+		return check
+	}
+	check.Message = fmt.Sprintf("%s available in %s", bytefmt.ByteSize(available), path)
+	if available < minAvailableSpace {
+		check.OK = false
+		check.Hint = "free up space or use another directory with --image-base-dir"
+	}
+	return check
+}
+
+func checkVersion(conn *libvirt.Libvirt) Check {
+	check := Check{
+		Name: "libvirt version",
+	}
+	version, err := conn.ConnectGetLibVersion()
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	check.Message = formatVersion(version)
+	if version < minLibvirtVersion {
+		check.Message += fmt.Sprintf(" is older than %s", formatVersion(minLibvirtVersion))
+		check.Hint = "upgrade libvirt"
+		return check
+	}
+	check.OK = true
+	return check
+}
+
+func formatVersion(version uint64) string {
+	return fmt.Sprintf("%d.%d.%d", version/1_000_000, version/1000%1000, version%1000)
+}
+
+// checkKVM checks the capabilities of the hypervisor since /dev/kvm is not
+// necessarily on the local host.
+func checkKVM(conn *libvirt.Libvirt) Check {
+	check := Check{
+		Name: "kvm",
+	}
+	xml, err := conn.ConnectGetCapabilities()
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	caps := &libvirtxml.Caps{}
+	err = caps.Unmarshal(xml)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	return kvmCheck(caps)
+}
+
+// kvmCheck checks whether KVM is available for the architecture of the host.
+func kvmCheck(caps *libvirtxml.Caps) Check {
+	check := Check{
+		Name: "kvm",
+	}
+	if caps.Host.CPU == nil || caps.Host.CPU.Arch == "" {
+		check.Message = "failed to get host architecture"
+		return check
+	}
+	for _, guest := range caps.Guests {
+		if guest.Arch.Name != caps.Host.CPU.Arch {
+			continue
+		}
+		for _, domain := range guest.Arch.Domains {
+			if domain.Type == "kvm" {
+				check.OK = true
+				check.Message = "available for " + guest.Arch.Name
+				return check
+			}
+		}
+	}
+	check.Message = "/dev/kvm is not available on the hypervisor host"
+	check.Hint = "enable virtualization in the BIOS/UEFI settings and load the kvm module (modprobe kvm_intel or kvm_amd)"
+	return check
+}
+
+func checkNetwork(conn *libvirt.Libvirt, name string) Check {
+	check := Check{
+		Name: "network " + name,
+	}
+	network, err := conn.NetworkLookupByName(name)
+	if err != nil {
+		check.Message = err.Error()
+		check.Hint = "create the network or use another network with --network"
+		return check
+	}
+	active, err := conn.NetworkIsActive(network)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	if active != 1 {
+		check.Message = "inactive"
+		check.Hint = fmt.Sprintf("virsh net-start %s && virsh net-autostart %s", name, name)
+		return check
+	}
+	check.OK = true
+	check.Message = "active"
+	return check
+}
+
+type poolStatusGetter interface {
+	PoolStatus(pool string) (*image.PoolStatus, error)
+}
+
+// CheckPools checks the storage pools which are used by the manager.
+func (m *Manager) CheckPools() []Check {
+	checks := []Check{}
+	seen := map[string]bool{}
+	for _, pool := range []string{m.BaseImagePool, m.VMImagePool, m.ConfigImagePool} {
+		if seen[pool] {
+			continue
+		}
+		seen[pool] = true
+		checks = append(checks, m.checkPool(pool))
+	}
+	return checks
+}
+
+func (m *Manager) checkPool(pool string) Check {
+	check := Check{
+		Name: "pool " + pool,
+	}
+
+	poolImage, ok := m.Image.(poolStatusGetter)
+	if !ok {
+		check.OK = true
+		check.Message = "pool checks not supported"
+		return check
+	}
+
+	status, err := poolImage.PoolStatus(pool)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+
+	if !status.Exists {
+		check.OK = true
+		check.Message = "does not exist yet, it gets created on first use"
+		return check
+	}
+
+	problems := []string{}
+	if !status.Persistent {
+		problems = append(problems, "transient (disappears after a restart of libvirtd)")
+	}
+	if !status.Active {
+		problems = append(problems, "inactive")
+	}
+	if !status.Autostart {
+		problems = append(problems, "autostart disabled")
+	}
+	if len(problems) > 0 {
+		check.Message = strings.Join(problems, ", ")
+		check.Hint = "vu repairs the pool on its next use (e.g. vu image list)"
+		return check
+	}
+
+	check.Message = fmt.Sprintf("%s of %s available", bytefmt.ByteSize(status.Available), bytefmt.ByteSize(status.Capacity))
+	if status.Available < minAvailableSpace {
+		check.Hint = "free up space in the pool or use another pool"
+		return check
+	}
+	check.OK = true
+	return check
+}
@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"testing"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+	"github.com/matryer/is"
+)
+
+func Test_kvmCheck(t *testing.T) {
+	is := is.New(t)
+
+	caps := &libvirtxml.Caps{}
+	check := kvmCheck(caps)
+	is.True(!check.OK) // no host CPU
+	is.Equal(check.Message, "failed to get host architecture")
+
+	caps.Host.CPU = &libvirtxml.CapsHostCPU{Arch: "x86_64"}
+	caps.Guests = []libvirtxml.CapsGuest{
+		{
+			Arch: libvirtxml.CapsGuestArch{
+				Name:    "x86_64",
+				Domains: []libvirtxml.CapsGuestDomain{{Type: "qemu"}},
+			},
+		},
+	}
+	is.True(!kvmCheck(caps).OK) // only emulated
+
+	caps.Guests[0].Arch.Domains = append(caps.Guests[0].Arch.Domains, libvirtxml.CapsGuestDomain{Type: "kvm"})
+	is.True(kvmCheck(caps).OK)
+}
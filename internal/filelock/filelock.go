@@ -0,0 +1,25 @@
+// Package filelock serializes the updates of files which are shared by
+// parallel invocations of vu.
+package filelock
+
+import (
+	"fmt"
+	"os"
+)
+
+// Run runs fn while holding an exclusive lock on lockFile. The lock file is
+// created with perm if it does not exist.
+func Run(lockFile string, perm os.FileMode, fn func() error) error {
+	f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = lock(f)
+	if err != nil {
+		return fmt.Errorf("failed to lock '%s': %w", lockFile, err)
+	}
+	defer func() { _ = unlock(f) }()
+	return fn()
+}
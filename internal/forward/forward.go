@@ -0,0 +1,219 @@
+// Package forward forwards TCP ports from the host to VMs.
+package forward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Port maps a port on the host to a port of the VM.
+type Port struct {
+	Host  int `json:"host"`
+	Guest int `json:"guest"`
+}
+
+func (p Port) String() string {
+	return fmt.Sprintf("%d:%d", p.Host, p.Guest)
+}
+
+// ParsePort parses a port mapping in the format HOST_PORT:GUEST_PORT or
+// PORT if both ports are the same.
+func ParsePort(value string) (Port, error) {
+	hostPort, guestPort, ok := strings.Cut(value, ":")
+	if !ok {
+		guestPort = hostPort
+	}
+	host, err := parsePortNumber(hostPort)
+	if err != nil {
+		return Port{}, fmt.Errorf("invalid port mapping '%s': %w", value, err)
+	}
+	guest, err := parsePortNumber(guestPort)
+	if err != nil {
+		return Port{}, fmt.Errorf("invalid port mapping '%s': %w", value, err)
+	}
+	return Port{
+		Host:  host,
+		Guest: guest,
+	}, nil
+}
+
+func parsePortNumber(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("port %d out of range", port)
+	}
+	return port, nil
+}
+
+// Listen opens the listeners for all ports on the address. If one listener
+// can not be opened, the already opened listeners are closed.
+func Listen(address string, ports []Port) ([]net.Listener, error) {
+	listeners := []net.Listener{}
+	for _, port := range ports {
+		l, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port.Host)))
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// dialTimeout is the timeout to connect to the guest.
+const dialTimeout = 5 * time.Second
+
+// Guest provides the IP address of the VM. If a connection to the address
+// fails, the address is resolved again, since the VM may have got another
+// address from DHCP.
+type Guest struct {
+	resolve func() (string, error)
+	mu      sync.Mutex
+	ip      string
+}
+
+// NewGuest returns a guest with the IP address ip. resolve returns the
+// current address of the VM. If it is nil, the address is never updated.
+func NewGuest(ip string, resolve func() (string, error)) *Guest {
+	return &Guest{
+		resolve: resolve,
+		ip:      ip,
+	}
+}
+
+// IP returns the last known IP address of the guest.
+func (g *Guest) IP() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.ip
+}
+
+// refresh resolves the address again if failedIP is still the current
+// address and returns the current address.
+func (g *Guest) refresh(failedIP string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.ip != failedIP {
+		return g.ip, nil
+	}
+	ip, err := g.resolve()
+	if err != nil {
+		return "", err
+	}
+	if ip != g.ip {
+		log.Printf("address of the guest changed from %s to %s", g.ip, ip)
+		g.ip = ip
+	}
+	return ip, nil
+}
+
+// dial connects to the port of the guest. If the connection fails, the
+// address of the guest is resolved again and if it changed, the connection is
+// retried with the new address.
+func (g *Guest) dial(port int) (net.Conn, error) {
+	ip := g.IP()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(port)), dialTimeout)
+	if err == nil || g.resolve == nil {
+		return conn, err
+	}
+	newIP, resolveErr := g.refresh(ip)
+	if resolveErr != nil || newIP == ip {
+		return nil, err
+	}
+	return net.DialTimeout("tcp", net.JoinHostPort(newIP, strconv.Itoa(port)), dialTimeout)
+}
+
+// Serve forwards the connections of the listeners to the ports of the guest
+// until the context is canceled. The listeners have to be in the same order as
+// the ports.
+func Serve(ctx context.Context, listeners []net.Listener, guest *Guest, ports []Port) error {
+	go func() {
+		<-ctx.Done()
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+
+	wg := &sync.WaitGroup{}
+	errs := make(chan error, len(listeners))
+	for i, l := range listeners {
+		wg.Add(1)
+		go func(l net.Listener, port int) {
+			defer wg.Done()
+			errs <- serve(ctx, l, guest, port)
+		}(l, ports[i].Guest)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func serve(ctx context.Context, l net.Listener, guest *Guest, port int) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go proxy(conn, guest, port)
+	}
+}
+
+func proxy(conn net.Conn, guest *Guest, port int) {
+	defer conn.Close()
+
+	targetConn, err := guest.dial(port)
+	if err != nil {
+		log.Printf("failed to connect %s to port %d of the guest: %s", conn.RemoteAddr(), port, err)
+		return
+	}
+	defer targetConn.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		copyAndCloseWrite(targetConn, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		copyAndCloseWrite(conn, targetConn)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+// copyAndCloseWrite copies from src to dst and then closes the write side of
+// dst, so that a half-close is passed on and the other direction continues.
+// On errors or if dst does not support half-closes both connections are
+// closed, which also ends the other direction.
+func copyAndCloseWrite(dst, src net.Conn) {
+	_, err := io.Copy(dst, src)
+	tcpConn, ok := dst.(*net.TCPConn)
+	if err == nil && ok {
+		_ = tcpConn.CloseWrite()
+		return
+	}
+	_ = dst.Close()
+	_ = src.Close()
+}
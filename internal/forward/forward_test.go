@@ -0,0 +1,154 @@
+package forward
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_ParsePort(t *testing.T) {
+	is := is.New(t)
+
+	port, err := ParsePort("8080:80")
+	is.NoErr(err)
+	is.Equal(port, Port{Host: 8080, Guest: 80})
+
+	port, err = ParsePort("22")
+	is.NoErr(err)
+	is.Equal(port, Port{Host: 22, Guest: 22}) // same port on both sides
+
+	_, err = ParsePort("8080:70000")
+	is.True(err != nil) // out of range
+}
+
+func Test_Serve(t *testing.T) {
+	is := is.New(t)
+
+	// guest which echoes the received data
+	guest, err := net.Listen("tcp", "127.0.0.1:0")
+	is.NoErr(err)
+	defer guest.Close()
+	go func() {
+		conn, err := guest.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	}()
+	guestPort := guest.Addr().(*net.TCPAddr).Port
+
+	ports := []Port{{Host: 0, Guest: guestPort}}
+	listeners, err := Listen("127.0.0.1", ports)
+	is.NoErr(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Serve(ctx, listeners, NewGuest("127.0.0.1", nil), ports)
+	}()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(listeners[0].Addr().(*net.TCPAddr).Port)))
+	is.NoErr(err)
+	_, err = conn.Write([]byte("hello"))
+	is.NoErr(err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	is.NoErr(err)
+	is.Equal(string(buf), "hello") // data forwarded to the guest and back
+	conn.Close()
+
+	cancel()
+	is.NoErr(<-done)
+}
+
+func Test_Serve_HalfClose(t *testing.T) {
+	is := is.New(t)
+
+	// guest which answers after it received all data
+	guest, err := net.Listen("tcp", "127.0.0.1:0")
+	is.NoErr(err)
+	defer guest.Close()
+	go func() {
+		conn, err := guest.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		_, _ = conn.Write(append(data, " world"...))
+	}()
+	guestPort := guest.Addr().(*net.TCPAddr).Port
+
+	ports := []Port{{Host: 0, Guest: guestPort}}
+	listeners, err := Listen("127.0.0.1", ports)
+	is.NoErr(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Serve(ctx, listeners, NewGuest("127.0.0.1", nil), ports)
+	}()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(listeners[0].Addr().(*net.TCPAddr).Port)))
+	is.NoErr(err)
+	_, err = conn.Write([]byte("hello"))
+	is.NoErr(err)
+	is.NoErr(conn.(*net.TCPConn).CloseWrite())
+	data, err := io.ReadAll(conn)
+	is.NoErr(err)
+	is.Equal(string(data), "hello world") // response after the half-close is forwarded
+	conn.Close()
+
+	cancel()
+	is.NoErr(<-done)
+}
+
+func Test_Serve_AddressChange(t *testing.T) {
+	is := is.New(t)
+
+	guest, err := net.Listen("tcp", "127.0.0.1:0")
+	is.NoErr(err)
+	defer guest.Close()
+	go func() {
+		conn, err := guest.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	}()
+	guestPort := guest.Addr().(*net.TCPAddr).Port
+
+	ports := []Port{{Host: 0, Guest: guestPort}}
+	listeners, err := Listen("127.0.0.1", ports)
+	is.NoErr(err)
+
+	// the guest is not reachable on the initial address anymore
+	g := NewGuest("::1", func() (string, error) {
+		return "127.0.0.1", nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Serve(ctx, listeners, g, ports)
+	}()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(listeners[0].Addr().(*net.TCPAddr).Port)))
+	is.NoErr(err)
+	_, err = conn.Write([]byte("hello"))
+	is.NoErr(err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	is.NoErr(err)
+	is.Equal(string(buf), "hello") // forwarded to the new address
+	is.Equal(g.IP(), "127.0.0.1")
+	conn.Close()
+
+	cancel()
+	is.NoErr(<-done)
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package forward
+
+import (
+	"os"
+	"syscall"
+)
+
+// DetachAttr returns the attributes to start a process which is detached
+// from the terminal.
+func DetachAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setsid: true,
+	}
+}
+
+func alive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+func terminate(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,39 @@
+//go:build windows
+// +build windows
+
+package forward
+
+import (
+	"os"
+	"syscall"
+)
+
+const detachedProcess = 0x00000008
+
+// DetachAttr returns the attributes to start a process which is detached
+// from the console.
+func DetachAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
+
+func alive(pid int) bool {
+	// FindProcess opens a handle to the process and fails if it does not
+	// exist
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
+
+// terminate kills the process since Windows does not support signals.
+func terminate(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
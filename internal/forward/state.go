@@ -0,0 +1,103 @@
+package forward
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// State describes a forwarding which runs in the background.
+type State struct {
+	PID     int    `json:"pid"`
+	URI     string `json:"uri"`
+	VM      string `json:"vm"`
+	Address string `json:"address"`
+	GuestIP string `json:"guestIP"`
+	Ports   []Port `json:"ports"`
+}
+
+// DefaultDir returns the directory for the state and the log files of the
+// forwardings which run in the background.
+func DefaultDir() (string, error) {
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve forward directory: %w", err)
+	}
+	return filepath.Join(userHome, ".config", "vu", "forward"), nil
+}
+
+// Name returns the base name of the state and the log file of a forwarding
+// which is identified by the VM and its first host port.
+func Name(vm string, ports []Port) string {
+	if len(ports) == 0 {
+		return vm
+	}
+	return fmt.Sprintf("%s-%d", vm, ports[0].Host)
+}
+
+// Save writes the state to dir.
+func (s *State) Save(dir string) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, Name(s.VM, s.Ports)+".json"), data, 0o644)
+}
+
+// Remove removes the state file from dir.
+func (s *State) Remove(dir string) error {
+	err := os.Remove(filepath.Join(dir, Name(s.VM, s.Ports)+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List returns the states of all forwardings in dir. States of processes
+// which no longer run are removed.
+func List(dir string) ([]State, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	states := []State{}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		s := State{}
+		err = json.Unmarshal(data, &s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", entry.Name(), err)
+		}
+		if !alive(s.PID) {
+			_ = s.Remove(dir)
+			continue
+		}
+		states = append(states, s)
+	}
+	return states, nil
+}
+
+// Stop stops the process of the forwarding and removes its state.
+func (s *State) Stop(dir string) error {
+	err := terminate(s.PID)
+	if err != nil {
+		return fmt.Errorf("failed to stop forwarding of vm '%s' (pid %d): %w", s.VM, s.PID, err)
+	}
+	return s.Remove(dir)
+}
@@ -19,7 +19,7 @@ func New(baseDir string) *Manager {
 	}
 }
 
-func (s *Manager) Create(pool, name string, img io.ReadCloser) (*image.Image, error) {
+func (s *Manager) Create(pool, name string, img io.ReadCloser, _ uint64) (*image.Image, error) {
 	dirPath := filepath.Join(s.dir, pool)
 	err := os.MkdirAll(dirPath, 0o750)
 	if err != nil {
@@ -0,0 +1,56 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned if an image or a pool does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is returned if an image with the same name exists
+	// already in the pool.
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrInUse is returned if an image can not be removed since it is used
+	// (e.g. as backing store of another image).
+	ErrInUse = errors.New("is in use")
+	// ErrInvalidState is returned if an operation is not possible in the
+	// current state of the image or pool.
+	ErrInvalidState = errors.New("is in an invalid state")
+)
+
+// Error is returned by the backends to describe a failed operation on an
+// image. Name is the name or the ID of the image. Kind is one of the sentinel
+// errors of this package and Err the optional underlying error of the
+// backend.
+type Error struct {
+	Pool string
+	Name string
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	var msg string
+	switch {
+	case e.Name == "":
+		msg = fmt.Sprintf("pool '%s' %s", e.Pool, e.Kind)
+	case e.Pool == "":
+		msg = fmt.Sprintf("image '%s' %s", e.Name, e.Kind)
+	default:
+		msg = fmt.Sprintf("image '%s' in pool '%s' %s", e.Name, e.Pool, e.Kind)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is reports whether target is the kind of the error.
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -44,7 +44,9 @@ func AddFromURL(mgr Manager, pool, name, src string, progress io.Writer) (*Image
 			return nil, fmt.Errorf("http status %d returned", resp.StatusCode)
 		}
 
-		size = uint64(resp.ContentLength)
+		if resp.ContentLength > 0 {
+			size = uint64(resp.ContentLength)
+		}
 		reader = resp.Body
 
 	} else {
@@ -60,7 +62,7 @@ func AddFromURL(mgr Manager, pool, name, src string, progress io.Writer) (*Image
 	if name == "" {
 		name = filepath.Base(u.Path)
 	}
-	image, err := mgr.Create(pool, name, reader)
+	image, err := mgr.Create(pool, name, reader, size)
 	if err != nil {
 		return nil, err
 	}
@@ -4,11 +4,26 @@ import "io"
 
 // Manager is the iterface which describes the image management. With create we can create an image in a certain pool (e.g. config isos, base images, images). The pool is to distingush between various image categories. It allows to retrieve only images of a certain type.
 type Manager interface {
-	Create(pool, name string, image io.ReadCloser) (*Image, error)
+	// Create creates a new image from the reader. Size is the size of the
+	// image in bytes. It can be zero if it is unknown, but pools which are
+	// not file based require it.
+	Create(pool, name string, image io.ReadCloser, size uint64) (*Image, error)
+	// CreateEmpty creates a new empty image with the size in bytes.
+	CreateEmpty(pool, name string, size uint64) (*Image, error)
 	Clone(baseImageID, targetPool, targetName string, size uint64) (*Image, error)
 	List(pool string) ([]Image, error)
 	Get(pool, name string) (*Image, error)
 	Remove(ID string) error
+	// Users returns the IDs of the images which use the image as backing
+	// store.
+	Users(ID string) ([]string, error)
+	// Path returns the location of a file with the name in the pool, which
+	// can be written by the hypervisor (e.g. a log file). It returns an
+	// empty string if the pool does not support files.
+	Path(pool, name string) (string, error)
+	// Download writes the content of the image starting at offset to w and
+	// returns the number of bytes written.
+	Download(ID string, w io.Writer, offset uint64) (uint64, error)
 }
 
 type Image struct {
@@ -2,10 +2,11 @@ package libvirt
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"path"
 	"path/filepath"
-	"strings"
 
 	"github.com/digitalocean/go-libvirt"
 	"github.com/dvob/vu/internal/image"
@@ -14,19 +15,74 @@ import (
 
 var _ image.Manager = &Manager{}
 
+// fileBasedPoolTypes are the pool types in which volumes are regular files.
+// In these pools clones are created as qcow2 overlays. In all other pools
+// (e.g. logical, zfs) volumes are block devices and clones are created as raw
+// copies.
+var fileBasedPoolTypes = map[string]bool{
+	"dir":      true,
+	"fs":       true,
+	"netfs":    true,
+	"gluster":  true,
+	"vstorage": true,
+}
+
+// PoolConfig describes a storage pool. If a pool with the name does not exist
+// yet, it gets created based on the configuration.
+type PoolConfig struct {
+	Name string `json:"name"`
+	// Type is the libvirt pool type (e.g. dir, fs, netfs, logical, zfs).
+	// Defaults to dir.
+	Type string `json:"type,omitempty"`
+	// Target is the path of the pool on the host. Defaults to a directory
+	// in the base path for the file based pool types.
+	Target string      `json:"target,omitempty"`
+	Source *PoolSource `json:"source,omitempty"`
+}
+
+// PoolSource describes the source of a storage pool. Which fields are
+// required depends on the pool type. For example netfs requires Host and Dir,
+// logical and zfs require Name.
+type PoolSource struct {
+	Host    string   `json:"host,omitempty"`
+	Dir     string   `json:"dir,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Devices []string `json:"devices,omitempty"`
+	Format  string   `json:"format,omitempty"`
+}
+
 type Manager struct {
 	basePath string
+	pools    map[string]PoolConfig
 	*libvirt.Libvirt
 }
 
-func New(basePath string, libvirt *libvirt.Libvirt) *Manager {
+// New returns a new image manager. Pools which do not exist are created
+// according to the pool configurations or as dir pool under basePath if no
+// configuration for a pool exists.
+func New(basePath string, pools []PoolConfig, libvirt *libvirt.Libvirt) *Manager {
+	poolConfigs := map[string]PoolConfig{}
+	for _, pool := range pools {
+		poolConfigs[pool.Name] = pool
+	}
 	return &Manager{
 		basePath,
+		poolConfigs,
 		libvirt,
 	}
 }
 
-func (m *Manager) Create(pool, name string, img io.ReadCloser) (*image.Image, error) {
+func (m *Manager) Create(pool, name string, img io.ReadCloser, size uint64) (*image.Image, error) {
+	sp, err := m.createOrGetPool(pool)
+	if err != nil {
+		return nil, fmt.Errorf("faild to get storage pool: %w", err)
+	}
+
+	poolType, err := m.poolType(*sp)
+	if err != nil {
+		return nil, err
+	}
+
 	vol := &libvirtxml.StorageVolume{
 		Name: name,
 		Capacity: &libvirtxml.StorageVolumeSize{
@@ -40,19 +96,23 @@ func (m *Manager) Create(pool, name string, img io.ReadCloser) (*image.Image, er
 		},
 	}
 
-	xml, err := vol.Marshal()
-	if err != nil {
-		return nil, err
+	// block devices can not grow during the upload
+	if !fileBasedPoolTypes[poolType] {
+		if size == 0 {
+			return nil, fmt.Errorf("size of image '%s' is required for pool '%s' of type '%s'", name, pool, poolType)
+		}
+		vol.Capacity.Value = size
+		vol.Target.Permissions = nil
 	}
 
-	sp, err := m.createOrGetPool(pool)
+	xml, err := vol.Marshal()
 	if err != nil {
-		return nil, fmt.Errorf("faild to get storage pool: %w", err)
+		return nil, err
 	}
 
 	sv, err := m.StorageVolCreateXML(*sp, xml, 0)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create volume: %w", err)
+		return nil, fmt.Errorf("failed to create volume: %w", mapError(pool, name, err))
 	}
 
 	reader := bufio.NewReader(img)
@@ -64,6 +124,15 @@ func (m *Manager) Create(pool, name string, img io.ReadCloser) (*image.Image, er
 		return nil, fmt.Errorf("failed to upload content: %w", err)
 	}
 
+	// libvirt creates the volume as raw and only probes the format of the
+	// uploaded content (e.g. qcow2) when the pool is refreshed
+	if fileBasedPoolTypes[poolType] {
+		err = m.StoragePoolRefresh(*sp, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to refresh pool: %w", mapError(pool, "", err))
+		}
+	}
+
 	location, err := m.StorageVolGetPath(sv)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get volume location: %w", err)
@@ -74,6 +143,50 @@ func (m *Manager) Create(pool, name string, img io.ReadCloser) (*image.Image, er
 	}, nil
 }
 
+// CreateEmpty creates an empty image. In file based pools the image is a
+// qcow2 image which only allocates space when it is used. In all other pools
+// it is a raw volume.
+func (m *Manager) CreateEmpty(pool, name string, size uint64) (*image.Image, error) {
+	sp, err := m.createOrGetPool(pool)
+	if err != nil {
+		return nil, fmt.Errorf("faild to get storage pool: %w", err)
+	}
+
+	poolType, err := m.poolType(*sp)
+	if err != nil {
+		return nil, err
+	}
+
+	format := "raw"
+	if fileBasedPoolTypes[poolType] {
+		format = "qcow2"
+	}
+
+	vol := &libvirtxml.StorageVolume{
+		Name: name,
+		Capacity: &libvirtxml.StorageVolumeSize{
+			Value: size,
+			Unit:  "b",
+		},
+		Target: &libvirtxml.StorageVolumeTarget{
+			Format: &libvirtxml.StorageVolumeTargetFormat{
+				Type: format,
+			},
+		},
+	}
+
+	xml, err := vol.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	sv, err := m.StorageVolCreateXML(*sp, xml, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create volume: %w", mapError(pool, name, err))
+	}
+	return m.Get(pool, sv.Name)
+}
+
 func (m *Manager) List(pool string) ([]image.Image, error) {
 	sp, err := m.createOrGetPool(pool)
 	if err != nil {
@@ -100,11 +213,112 @@ func (m *Manager) List(pool string) ([]image.Image, error) {
 }
 
 func (m *Manager) Remove(ID string) error {
-	vol, err := m.StorageVolLookupByPath(ID)
+	vol, err := m.lookupPath(ID)
 	if err != nil {
-		return fmt.Errorf("faild to get storage pool: %s", err)
+		return mapError("", ID, err)
+	}
+	return mapError(vol.Pool, vol.Name, m.StorageVolDelete(vol, 0))
+}
+
+// lookupPath returns the volume with the path. Files which were not created
+// through libvirt (e.g. log files) are only known after a refresh of the
+// pool.
+func (m *Manager) lookupPath(volPath string) (libvirt.StorageVol, error) {
+	vol, err := m.StorageVolLookupByPath(volPath)
+	if err == nil || !errors.Is(mapError("", volPath, err), image.ErrNotFound) {
+		return vol, err
+	}
+	sp, poolErr := m.StoragePoolLookupByTargetPath(path.Dir(volPath))
+	if poolErr != nil {
+		return vol, err
 	}
-	return m.StorageVolDelete(vol, 0)
+	poolErr = m.StoragePoolRefresh(sp, 0)
+	if poolErr != nil {
+		return vol, err
+	}
+	return m.StorageVolLookupByPath(volPath)
+}
+
+// Path returns the path of the file in the target directory of file based
+// pools.
+func (m *Manager) Path(pool, name string) (string, error) {
+	sp, err := m.createOrGetPool(pool)
+	if err != nil {
+		return "", fmt.Errorf("faild to get storage pool: %w", err)
+	}
+	poolDef, err := m.poolDef(*sp)
+	if err != nil {
+		return "", err
+	}
+	if !fileBasedPoolTypes[poolDef.Type] || poolDef.Target == nil || poolDef.Target.Path == "" {
+		return "", nil
+	}
+	return path.Join(poolDef.Target.Path, name), nil
+}
+
+func (m *Manager) Download(ID string, w io.Writer, offset uint64) (uint64, error) {
+	vol, err := m.lookupPath(ID)
+	if err != nil {
+		return 0, mapError("", ID, err)
+	}
+	_, capacity, _, err := m.StorageVolGetInfo(vol)
+	if err != nil {
+		return 0, err
+	}
+	if offset >= capacity {
+		return 0, nil
+	}
+	cw := &countWriter{w: w}
+	err = m.StorageVolDownload(vol, cw, offset, capacity-offset, 0)
+	if err != nil {
+		return cw.n, fmt.Errorf("failed to download '%s': %w", ID, err)
+	}
+	return cw.n, nil
+}
+
+type countWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += uint64(n)
+	return n, err
+}
+
+// Users returns the paths of all volumes in the active pools which use the
+// volume with the given path as backing store. Only file based pools are
+// checked, since clones in other pools are copies.
+func (m *Manager) Users(ID string) ([]string, error) {
+	pools, _, err := m.ConnectListAllStoragePools(1, libvirt.ConnectListStoragePoolsActive)
+	if err != nil {
+		return nil, err
+	}
+	users := []string{}
+	for _, pool := range pools {
+		poolType, err := m.poolType(pool)
+		if err != nil {
+			return nil, err
+		}
+		if !fileBasedPoolTypes[poolType] {
+			continue
+		}
+		vols, _, err := m.StoragePoolListAllVolumes(pool, 1, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, vol := range vols {
+			volDef, err := m.volume(vol)
+			if err != nil {
+				return nil, err
+			}
+			if volDef.BackingStore != nil && volDef.BackingStore.Path == ID {
+				users = append(users, volDef.Target.Path)
+			}
+		}
+	}
+	return users, nil
 }
 
 func (m *Manager) Get(pool, name string) (*image.Image, error) {
@@ -115,7 +329,7 @@ func (m *Manager) Get(pool, name string) (*image.Image, error) {
 
 	sv, err := m.StorageVolLookupByName(*sp, name)
 	if err != nil {
-		return nil, err
+		return nil, mapError(pool, name, err)
 	}
 
 	location, err := m.StorageVolGetPath(sv)
@@ -128,26 +342,89 @@ func (m *Manager) Get(pool, name string) (*image.Image, error) {
 	}, nil
 }
 
+// Clone creates a new image based on the base image. In file based pools the
+// new image is a qcow2 overlay which uses the base image as backing store. In
+// all other pools the base image gets copied into a new raw volume.
 func (m *Manager) Clone(baseImageID, pool, name string, newSize uint64) (*image.Image, error) {
 	sp, err := m.createOrGetPool(pool)
 	if err != nil {
 		return nil, fmt.Errorf("faild to get storage pool: %s", err)
 	}
 
-	// TODO add owner and group
+	poolType, err := m.poolType(*sp)
+	if err != nil {
+		return nil, err
+	}
+
+	baseVol, err := m.StorageVolLookupByPath(baseImageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get base image: %w", mapError("", baseImageID, err))
+	}
+
+	baseVolDef, err := m.volume(baseVol)
+	if err != nil {
+		return nil, err
+	}
+
+	var sv libvirt.StorageVol
+	if fileBasedPoolTypes[poolType] {
+		baseVolDef, err = m.probeVolume(baseVol, baseVolDef)
+		if err != nil {
+			return nil, err
+		}
+		sv, err = m.cloneOverlay(*sp, baseVolDef, name, newSize)
+	} else {
+		sv, err = m.cloneCopy(*sp, baseVol, baseVolDef, name, newSize)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone image: %w", mapError(pool, name, err))
+	}
+	return m.Get(pool, sv.Name)
+}
+
+// probeVolume returns the volume with the probed format. Base images which
+// were uploaded without a refresh of the pool are listed as raw even if they
+// are qcow2 images, so the pool is refreshed for all volumes which are not
+// qcow2.
+func (m *Manager) probeVolume(vol libvirt.StorageVol, volDef *libvirtxml.StorageVolume) (*libvirtxml.StorageVolume, error) {
+	if volDef.Target.Format != nil && volDef.Target.Format.Type == "qcow2" {
+		return volDef, nil
+	}
+	sp, err := m.StoragePoolLookupByVolume(vol)
+	if err != nil {
+		return nil, err
+	}
+	err = m.StoragePoolRefresh(sp, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh pool: %w", mapError(sp.Name, "", err))
+	}
+	return m.volume(vol)
+}
+
+// TODO add owner and group
+func (m *Manager) cloneOverlay(sp libvirt.StoragePool, base *libvirtxml.StorageVolume, name string, newSize uint64) (libvirt.StorageVol, error) {
+	xml, err := overlayVolume(base, name, newSize).Marshal()
+	if err != nil {
+		return libvirt.StorageVol{}, err
+	}
+	return m.StorageVolCreateXML(sp, xml, 0)
+}
+
+// overlayVolume returns a qcow2 volume with base as backing store. If the
+// format of the base is unknown, it is treated as qcow2 like the base images
+// in file based pools.
+func overlayVolume(base *libvirtxml.StorageVolume, name string, newSize uint64) *libvirtxml.StorageVolume {
 	vol := &libvirtxml.StorageVolume{
 		Name: name,
 		Target: &libvirtxml.StorageVolumeTarget{
 			Format: &libvirtxml.StorageVolumeTargetFormat{
-				// TODO: should not use fix format here
 				Type: "qcow2",
 			},
 		},
 		BackingStore: &libvirtxml.StorageVolumeBackingStore{
-			Path: baseImageID,
+			Path: base.Target.Path,
 			Format: &libvirtxml.StorageVolumeTargetFormat{
-				// TODO: should not use fix format here
-				Type: "qcow2",
+				Type: backingFormat(base),
 			},
 		},
 	}
@@ -158,45 +435,316 @@ func (m *Manager) Clone(baseImageID, pool, name string, newSize uint64) (*image.
 			Unit:  "b",
 		}
 	}
+	return vol
+}
+
+func (m *Manager) cloneCopy(sp libvirt.StoragePool, baseVol libvirt.StorageVol, base *libvirtxml.StorageVolume, name string, newSize uint64) (libvirt.StorageVol, error) {
+	size := newSize
+	if base.Capacity != nil && base.Capacity.Value > size {
+		size = base.Capacity.Value
+	}
+
+	vol := &libvirtxml.StorageVolume{
+		Name: name,
+		Capacity: &libvirtxml.StorageVolumeSize{
+			Value: size,
+			Unit:  "b",
+		},
+		Target: &libvirtxml.StorageVolumeTarget{
+			Format: &libvirtxml.StorageVolumeTargetFormat{
+				Type: "raw",
+			},
+		},
+	}
 
 	xml, err := vol.Marshal()
+	if err != nil {
+		return libvirt.StorageVol{}, err
+	}
+	return m.StorageVolCreateXMLFrom(sp, xml, baseVol, 0)
+}
+
+func (m *Manager) volume(vol libvirt.StorageVol) (*libvirtxml.StorageVolume, error) {
+	xml, err := m.StorageVolGetXMLDesc(vol, 0)
 	if err != nil {
 		return nil, err
 	}
+	volDef := &libvirtxml.StorageVolume{}
+	err = volDef.Unmarshal(xml)
+	if err != nil {
+		return nil, err
+	}
+	if volDef.Target == nil {
+		volDef.Target = &libvirtxml.StorageVolumeTarget{}
+	}
+	return volDef, nil
+}
 
-	sv, err := m.StorageVolCreateXML(*sp, xml, 0)
+// backingFormat returns the format of a base image in a file based pool.
+// Base images without a format are qcow2 images.
+func backingFormat(base *libvirtxml.StorageVolume) string {
+	if base.Target == nil || base.Target.Format == nil {
+		return "qcow2"
+	}
+	switch base.Target.Format.Type {
+	case "", "none", "unknown":
+		return "qcow2"
+	default:
+		return base.Target.Format.Type
+	}
+}
+
+func (m *Manager) poolType(sp libvirt.StoragePool) (string, error) {
+	poolDef, err := m.poolDef(sp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to clone image: %w", err)
+		return "", err
 	}
-	return m.Get(pool, sv.Name)
+	return poolDef.Type, nil
 }
 
-func (m *Manager) createOrGetPool(pool string) (*libvirt.StoragePool, error) {
+func (m *Manager) poolDef(sp libvirt.StoragePool) (*libvirtxml.StoragePool, error) {
+	xml, err := m.StoragePoolGetXMLDesc(sp, 0)
+	if err != nil {
+		return nil, err
+	}
+	poolDef := &libvirtxml.StoragePool{}
+	err = poolDef.Unmarshal(xml)
+	if err != nil {
+		return nil, err
+	}
+	return poolDef, nil
+}
+
+// poolConfig returns the configuration for a pool with defaults applied.
+func (m *Manager) poolConfig(pool string) PoolConfig {
+	cfg, ok := m.pools[pool]
+	if !ok {
+		cfg = PoolConfig{
+			Name: pool,
+		}
+	}
+	if cfg.Type == "" {
+		cfg.Type = "dir"
+	}
+	if cfg.Target == "" && fileBasedPoolTypes[cfg.Type] {
+		cfg.Target = filepath.Join(m.basePath, pool)
+	}
+	return cfg
+}
+
+// needsBuild returns true if the pool has to be built before it can be used.
+// File based pools need their target directory. Other pools are only built if
+// devices are configured, otherwise an existing source (e.g. a volume group)
+// is expected.
+func (cfg PoolConfig) needsBuild() bool {
+	return fileBasedPoolTypes[cfg.Type] || (cfg.Source != nil && len(cfg.Source.Devices) > 0)
+}
+
+func (cfg PoolConfig) storagePool() *libvirtxml.StoragePool {
+	storagePool := &libvirtxml.StoragePool{
+		Type: cfg.Type,
+		Name: cfg.Name,
+	}
+	if cfg.Target != "" {
+		storagePool.Target = &libvirtxml.StoragePoolTarget{
+			Path: cfg.Target,
+		}
+	}
+	if cfg.Source == nil {
+		return storagePool
+	}
+
+	source := &libvirtxml.StoragePoolSource{
+		Name: cfg.Source.Name,
+	}
+	if cfg.Source.Host != "" {
+		source.Host = []libvirtxml.StoragePoolSourceHost{
+			{
+				Name: cfg.Source.Host,
+			},
+		}
+	}
+	if cfg.Source.Dir != "" {
+		source.Dir = &libvirtxml.StoragePoolSourceDir{
+			Path: cfg.Source.Dir,
+		}
+	}
+	for _, dev := range cfg.Source.Devices {
+		source.Device = append(source.Device, libvirtxml.StoragePoolSourceDevice{
+			Path: dev,
+		})
+	}
+	if cfg.Source.Format != "" {
+		source.Format = &libvirtxml.StoragePoolSourceFormat{
+			Type: cfg.Source.Format,
+		}
+	}
+	storagePool.Source = source
+	return storagePool
+}
+
+// PoolStatus describes the state of a storage pool.
+type PoolStatus struct {
+	Name       string
+	Exists     bool
+	Active     bool
+	Persistent bool
+	Autostart  bool
+	Capacity   uint64
+	Available  uint64
+}
+
+// PoolStatus returns the status of a storage pool. Pools which do not exist
+// are not an error since they get created on first use.
+func (m *Manager) PoolStatus(pool string) (*PoolStatus, error) {
+	status := &PoolStatus{
+		Name: pool,
+	}
 	sp, err := m.StoragePoolLookupByName(pool)
-	if err == nil {
-		return &sp, nil
+	if err != nil {
+		if isPoolNotFound(err) {
+			return status, nil
+		}
+		return nil, err
 	}
+	status.Exists = true
 
-	// TODO: seems that the underlaying errors of libvirt are not exported
-	if !strings.Contains(err.Error(), "Storage pool not found") {
+	active, err := m.StoragePoolIsActive(sp)
+	if err != nil {
 		return nil, err
 	}
+	status.Active = active == 1
 
-	storagePool := libvirtxml.StoragePool{
-		Type: "dir",
-		Name: pool,
-		Target: &libvirtxml.StoragePoolTarget{
-			Path: filepath.Join(m.basePath, pool),
-		},
+	persistent, err := m.StoragePoolIsPersistent(sp)
+	if err != nil {
+		return nil, err
 	}
+	status.Persistent = persistent == 1
 
-	xml, err := storagePool.Marshal()
+	autostart, err := m.StoragePoolGetAutostart(sp)
 	if err != nil {
 		return nil, err
 	}
-	sp, err = m.StoragePoolCreateXML(xml, libvirt.StoragePoolCreateWithBuild)
+	status.Autostart = autostart == 1
+
+	if status.Active {
+		_, status.Capacity, _, status.Available, err = m.StoragePoolGetInfo(sp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// createOrGetPool returns the pool. If the pool does not exist it gets
+// defined. Existing pools which are inactive or transient get repaired.
+func (m *Manager) createOrGetPool(pool string) (*libvirt.StoragePool, error) {
+	sp, err := m.StoragePoolLookupByName(pool)
+	if err != nil {
+		if !isPoolNotFound(err) {
+			return nil, err
+		}
+		sp, err = m.definePool(pool)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create storage pool: %w", err)
+		}
+	}
+
+	sp, err = m.repairPool(sp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create storage pool: %w", err)
+		return nil, fmt.Errorf("failed to repair storage pool '%s': %w", pool, err)
 	}
 	return &sp, nil
 }
+
+// definePool defines a new persistent pool which is started automatically.
+func (m *Manager) definePool(pool string) (libvirt.StoragePool, error) {
+	cfg := m.poolConfig(pool)
+	storagePool := cfg.storagePool()
+
+	xml, err := storagePool.Marshal()
+	if err != nil {
+		return libvirt.StoragePool{}, err
+	}
+
+	sp, err := m.StoragePoolDefineXML(xml, 0)
+	if err != nil {
+		return sp, err
+	}
+
+	if cfg.needsBuild() {
+		err = m.StoragePoolBuild(sp, libvirt.StoragePoolBuildNew)
+		if err != nil {
+			// try undo
+			_ = m.StoragePoolUndefine(sp)
+			return sp, err
+		}
+	}
+
+	return sp, m.StoragePoolSetAutostart(sp, 1)
+}
+
+// repairPool makes sure that the pool is persistent, started automatically and
+// active. Transient pools (e.g. created by earlier versions of vu) are defined
+// persistently, since they would disappear after a restart of libvirtd.
+func (m *Manager) repairPool(sp libvirt.StoragePool) (libvirt.StoragePool, error) {
+	persistent, err := m.StoragePoolIsPersistent(sp)
+	if err != nil {
+		return sp, err
+	}
+	if persistent != 1 {
+		xml, err := m.StoragePoolGetXMLDesc(sp, libvirt.StorageXMLInactive)
+		if err != nil {
+			return sp, err
+		}
+		sp, err = m.StoragePoolDefineXML(xml, 0)
+		if err != nil {
+			return sp, err
+		}
+	}
+
+	autostart, err := m.StoragePoolGetAutostart(sp)
+	if err != nil {
+		return sp, err
+	}
+	if autostart != 1 {
+		err = m.StoragePoolSetAutostart(sp, 1)
+		if err != nil {
+			return sp, err
+		}
+	}
+
+	active, err := m.StoragePoolIsActive(sp)
+	if err != nil {
+		return sp, err
+	}
+	if active != 1 {
+		err = m.StoragePoolCreate(sp, libvirt.StoragePoolCreateNormal)
+	}
+	return sp, err
+}
+
+func isPoolNotFound(err error) bool {
+	var libvirtErr libvirt.Error
+	return errors.As(err, &libvirtErr) && libvirt.ErrorNumber(libvirtErr.Code) == libvirt.ErrNoStoragePool
+}
+
+// mapError maps libvirt errors to the errors of the image package.
+func mapError(pool, name string, err error) error {
+	var libvirtErr libvirt.Error
+	if !errors.As(err, &libvirtErr) {
+		return err
+	}
+	switch libvirt.ErrorNumber(libvirtErr.Code) {
+	case libvirt.ErrNoStoragePool:
+		return &image.Error{Pool: pool, Kind: image.ErrNotFound}
+	case libvirt.ErrNoStorageVol:
+		return &image.Error{Pool: pool, Name: name, Kind: image.ErrNotFound}
+	case libvirt.ErrStorageVolExist:
+		return &image.Error{Pool: pool, Name: name, Kind: image.ErrAlreadyExists}
+	case libvirt.ErrOperationInvalid:
+		return &image.Error{Pool: pool, Name: name, Kind: image.ErrInvalidState, Err: err}
+	default:
+		return err
+	}
+}
@@ -0,0 +1,59 @@
+package libvirt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/dvob/vu/internal/image"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+	"github.com/matryer/is"
+)
+
+func Test_mapError(t *testing.T) {
+	is := is.New(t)
+
+	err := mapError("base", "foo.img", libvirt.Error{Code: uint32(libvirt.ErrNoStorageVol)})
+	is.True(errors.Is(err, image.ErrNotFound))
+	is.Equal(err.Error(), "image 'foo.img' in pool 'base' not found")
+
+	err = mapError("base", "foo.img", libvirt.Error{Code: uint32(libvirt.ErrStorageVolExist)})
+	is.True(errors.Is(err, image.ErrAlreadyExists))
+
+	err = mapError("base", "", libvirt.Error{Code: uint32(libvirt.ErrNoStoragePool)})
+	is.Equal(err.Error(), "pool 'base' not found")
+
+	err = mapError("base", "foo.img", libvirt.Error{Code: uint32(libvirt.ErrOperationInvalid), Message: "busy"})
+	is.True(errors.Is(err, image.ErrInvalidState))
+
+	other := libvirt.Error{Code: uint32(libvirt.ErrInternalError)}
+	is.Equal(mapError("base", "foo.img", other), other) // unknown errors are not mapped
+
+	is.NoErr(mapError("base", "foo.img", nil))
+}
+
+func Test_overlayVolume(t *testing.T) {
+	is := is.New(t)
+
+	// uploaded base images have no format until the pool is refreshed
+	base := &libvirtxml.StorageVolume{
+		Target: &libvirtxml.StorageVolumeTarget{
+			Path: "/var/lib/vu/base/jammy.img",
+		},
+	}
+	vol := overlayVolume(base, "vm1.qcow2", 0)
+	is.Equal(vol.Target.Format.Type, "qcow2")
+	is.Equal(vol.BackingStore.Path, "/var/lib/vu/base/jammy.img")
+	is.Equal(vol.BackingStore.Format.Type, "qcow2")
+	is.Equal(vol.Capacity, nil) // size of the base
+
+	xml, err := vol.Marshal()
+	is.NoErr(err)
+	is.True(strings.Contains(xml, "<backingStore>\n    <path>/var/lib/vu/base/jammy.img</path>\n    <format type=\"qcow2\"></format>"))
+
+	base.Target.Format = &libvirtxml.StorageVolumeTargetFormat{Type: "raw"}
+	vol = overlayVolume(base, "vm1.qcow2", 10_000)
+	is.Equal(vol.BackingStore.Format.Type, "raw")
+	is.Equal(vol.Capacity.Value, uint64(10_000))
+}
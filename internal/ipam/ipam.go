@@ -0,0 +1,218 @@
+// Package ipam records the IP addresses which are allocated to VMs. The
+// allocations are stored in a file which is locked during changes, so that
+// parallel invocations of vu never allocate the same address twice.
+package ipam
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/dvob/vu/internal/filelock"
+)
+
+// Allocation is an address which is allocated to a VM in a network of a
+// hypervisor host.
+type Allocation struct {
+	URI     string `json:"uri"`
+	Network string `json:"network"`
+	VM      string `json:"vm"`
+	Address string `json:"address"`
+}
+
+type allocations struct {
+	Allocations []Allocation `json:"allocations"`
+}
+
+// Store manages the allocations of the hypervisor host with the URI.
+type Store struct {
+	file string
+	uri  string
+}
+
+// DefaultFile returns the location of the default allocation file.
+func DefaultFile() (string, error) {
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve ipam file: %w", err)
+	}
+	return filepath.Join(userHome, ".config", "vu", "ipam.json"), nil
+}
+
+func New(file, uri string) *Store {
+	return &Store{
+		file: file,
+		uri:  uri,
+	}
+}
+
+// Allocate allocates the first free IPv4 address in the subnet which is
+// neither allocated already nor used according to used.
+func (s *Store) Allocate(network, vm string, subnet *net.IPNet, used func(net.IP) bool) (net.IP, error) {
+	var ip net.IP
+	err := s.update(func(a *allocations) error {
+		allocated := map[string]bool{}
+		for _, alloc := range a.Allocations {
+			if alloc.URI == s.uri && alloc.Network == network {
+				allocated[alloc.Address] = true
+			}
+		}
+
+		ones, bits := subnet.Mask.Size()
+		first := binary.BigEndian.Uint32(subnet.IP.To4())
+		last := first + 1<<(bits-ones) - 1
+		// skip the network and the broadcast address
+		for n := first + 1; n < last; n++ {
+			candidate := make(net.IP, 4)
+			binary.BigEndian.PutUint32(candidate, n)
+			if allocated[candidate.String()] || used(candidate) {
+				continue
+			}
+			ip = candidate
+			a.Allocations = append(a.Allocations, s.allocation(network, vm, ip))
+			return nil
+		}
+		return fmt.Errorf("no free address in network '%s'", network)
+	})
+	return ip, err
+}
+
+// Reserve records an address which was chosen explicitly. It fails if the
+// address is allocated to another VM. It returns false if the address was
+// recorded for the VM already.
+func (s *Store) Reserve(network, vm string, ip net.IP) (bool, error) {
+	added := false
+	err := s.update(func(a *allocations) error {
+		for _, alloc := range a.Allocations {
+			if alloc.URI != s.uri || alloc.Network != network || alloc.Address != ip.String() {
+				continue
+			}
+			if alloc.VM != vm {
+				return fmt.Errorf("address %s in network '%s' is allocated to vm '%s'", ip, network, alloc.VM)
+			}
+			return nil
+		}
+		a.Allocations = append(a.Allocations, s.allocation(network, vm, ip))
+		added = true
+		return nil
+	})
+	return added, err
+}
+
+// Release releases all addresses of the VM.
+func (s *Store) Release(vm string) error {
+	return s.update(func(a *allocations) error {
+		remaining := []Allocation{}
+		for _, alloc := range a.Allocations {
+			if alloc.URI == s.uri && alloc.VM == vm {
+				continue
+			}
+			remaining = append(remaining, alloc)
+		}
+		a.Allocations = remaining
+		return nil
+	})
+}
+
+// Remove releases the allocations. The URI of the allocations is ignored.
+func (s *Store) Remove(allocs ...Allocation) error {
+	return s.update(func(a *allocations) error {
+		remaining := []Allocation{}
+		for _, alloc := range a.Allocations {
+			if alloc.URI == s.uri && containsAllocation(allocs, alloc) {
+				continue
+			}
+			remaining = append(remaining, alloc)
+		}
+		a.Allocations = remaining
+		return nil
+	})
+}
+
+func containsAllocation(allocs []Allocation, alloc Allocation) bool {
+	for _, a := range allocs {
+		if a.Network == alloc.Network && a.VM == alloc.VM && a.Address == alloc.Address {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the allocations of the hypervisor host.
+func (s *Store) List() ([]Allocation, error) {
+	a, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	list := []Allocation{}
+	for _, alloc := range a.Allocations {
+		if alloc.URI == s.uri {
+			list = append(list, alloc)
+		}
+	}
+	return list, nil
+}
+
+func (s *Store) allocation(network, vm string, ip net.IP) Allocation {
+	return Allocation{
+		URI:     s.uri,
+		Network: network,
+		VM:      vm,
+		Address: ip.String(),
+	}
+}
+
+// update locks the store, applies fn to the allocations and saves them if fn
+// does not fail.
+func (s *Store) update(fn func(*allocations) error) error {
+	err := os.MkdirAll(filepath.Dir(s.file), 0o755)
+	if err != nil {
+		return err
+	}
+	return filelock.Run(s.file+".lock", 0o644, func() error {
+		a, err := s.load()
+		if err != nil {
+			return err
+		}
+		err = fn(a)
+		if err != nil {
+			return err
+		}
+		return s.save(a)
+	})
+}
+
+func (s *Store) load() (*allocations, error) {
+	a := &allocations{}
+	data, err := os.ReadFile(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, a)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", s.file, err)
+	}
+	return a, nil
+}
+
+// save writes the allocations to a temporary file first, so that readers
+// never see a partially written file.
+func (s *Store) save(a *allocations) error {
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpFile := s.file + ".tmp"
+	err = os.WriteFile(tmpFile, data, 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, s.file)
+}
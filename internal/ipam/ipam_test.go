@@ -0,0 +1,58 @@
+package ipam
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_Store(t *testing.T) {
+	is := is.New(t)
+
+	file := filepath.Join(t.TempDir(), "ipam.json")
+	s := New(file, "unix:/test")
+	_, subnet, _ := net.ParseCIDR("10.10.0.0/29")
+	gateway := net.ParseIP("10.10.0.1")
+	used := func(ip net.IP) bool { return ip.Equal(gateway) }
+
+	ip, err := s.Allocate("lab", "vm1", subnet, used)
+	is.NoErr(err)
+	is.Equal(ip.String(), "10.10.0.2") // gateway skipped
+
+	added, err := s.Reserve("lab", "vm2", net.ParseIP("10.10.0.3"))
+	is.NoErr(err)
+	is.True(added)
+	added, err = s.Reserve("lab", "vm2", net.ParseIP("10.10.0.3"))
+	is.NoErr(err)
+	is.True(!added) // recorded already
+	_, err = s.Reserve("lab", "vm3", net.ParseIP("10.10.0.3"))
+	is.True(err != nil) // allocated to vm2
+
+	ip, err = s.Allocate("lab", "vm3", subnet, used)
+	is.NoErr(err)
+	is.Equal(ip.String(), "10.10.0.4") // reserved address skipped
+
+	// other hypervisor hosts are independent
+	ip, err = New(file, "unix:/other").Allocate("lab", "vm1", subnet, used)
+	is.NoErr(err)
+	is.Equal(ip.String(), "10.10.0.2")
+
+	is.NoErr(s.Release("vm1"))
+	ip, err = s.Allocate("lab", "vm4", subnet, used)
+	is.NoErr(err)
+	is.Equal(ip.String(), "10.10.0.2") // released address reused
+
+	list, err := s.List()
+	is.NoErr(err)
+	is.Equal(len(list), 3)
+
+	// only the given allocation is removed and not all of vm4
+	ip, err = s.Allocate("lab", "vm4", subnet, used)
+	is.NoErr(err)
+	is.NoErr(s.Remove(Allocation{Network: "lab", VM: "vm4", Address: ip.String()}))
+	list, err = s.List()
+	is.NoErr(err)
+	is.Equal(len(list), 3)
+}
@@ -8,39 +8,111 @@ import (
 
 	"github.com/digitalocean/go-libvirt"
 	image "github.com/dvob/vu/internal/image/libvirt"
+	"github.com/dvob/vu/internal/ipam"
+	network "github.com/dvob/vu/internal/network/libvirt"
+	"github.com/dvob/vu/internal/sshconfig"
+	vmapi "github.com/dvob/vu/internal/vm"
 	vm "github.com/dvob/vu/internal/vm/libvirt"
 	"github.com/spf13/cobra"
 )
 
 type LibvirtOptions struct {
-	URI          string
-	BaseImageDir string
+	URI             string
+	BaseImageDir    string
+	ConfigImagePool string
+	BaseImagePool   string
+	VMImagePool     string
+	// Pools describes how pools are created if they do not exist yet.
+	Pools []image.PoolConfig
+	// Address defines how the IP addresses of the VMs are determined.
+	Address vmapi.AddressOptions
+	// Context is the name of the context which is used.
+	Context string
 }
 
 func (o *LibvirtOptions) BindFlags(cmd *cobra.Command, prefix string) {
 	cmd.Flags().StringVar(&o.URI, prefix+"uri", o.URI, "URI to connecto to libvirtd. either a unix socket in the format unix:/socket/path or an IP in the format tcp:127.0.0.1.")
 	cmd.Flags().StringVar(&o.BaseImageDir, prefix+"image-base-dir", o.BaseImageDir, "Base directory to create new storage pools for the images.")
+	cmd.Flags().StringVar(&o.ConfigImagePool, prefix+"config-pool", o.ConfigImagePool, "Storage pool for the cloud-init config ISOs.")
+	cmd.Flags().StringVar(&o.BaseImagePool, prefix+"base-pool", o.BaseImagePool, "Storage pool for the base images.")
+	cmd.Flags().StringVar(&o.VMImagePool, prefix+"vm-pool", o.VMImagePool, "Storage pool for the VM images.")
+	cmd.Flags().StringSliceVar(&o.Address.Sources, prefix+"address-source", o.Address.Sources, "Sources of the IP addresses of the VMs in the order they are queried (agent, lease, arp).")
+	cmd.Flags().StringVar(&o.Address.Interface, prefix+"preferred-interface", o.Address.Interface, "Prefer the IP address of this interface. Either the name of the interface in the VM (requires the guest agent) or the name of the network.")
+	cmd.Flags().StringVar(&o.Address.Subnet, prefix+"preferred-subnet", o.Address.Subnet, "Prefer an IP address in this subnet.")
 }
 
 func NewLibvirtDefaultOptions() *LibvirtOptions {
 	return &LibvirtOptions{
-		URI:          "unix:/var/run/libvirt/libvirt-sock",
-		BaseImageDir: "/var/lib/libvirt/images/vu",
+		URI:             "unix:/var/run/libvirt/libvirt-sock",
+		Context:         "default",
+		BaseImageDir:    "/var/lib/libvirt/images/vu",
+		ConfigImagePool: "config",
+		BaseImagePool:   "base",
+		VMImagePool:     "vm",
+		Address:         vmapi.DefaultAddressOptions(),
 	}
 }
 
 func NewLibvirtManager(o *LibvirtOptions) (*Manager, error) {
+	err := o.Address.Validate()
+	if err != nil {
+		return nil, err
+	}
 	libvirtConn, err := connectLibvirt(o.URI)
 	if err != nil {
 		return nil, err
 	}
+	ipamFile, err := ipam.DefaultFile()
+	if err != nil {
+		return nil, err
+	}
+	sshConfigFile, err := sshconfig.DefaultFile()
+	if err != nil {
+		return nil, err
+	}
+	knownHostsFile, err := sshconfig.DefaultKnownHostsFile()
+	if err != nil {
+		return nil, err
+	}
+	m := newLibvirtManager(o, libvirtConn)
+	m.URI = o.URI
+	m.Context = o.Context
+	m.IPAM = ipam.New(ipamFile, o.URI)
+	m.SSHConfigFile = sshConfigFile
+	m.KnownHostsFile = knownHostsFile
+	return m, nil
+}
+
+func newLibvirtManager(o *LibvirtOptions, libvirtConn *libvirt.Libvirt) *Manager {
 	return &Manager{
-		ConfigImagePool: "config",
-		BaseImagePool:   "base",
-		VMImagePool:     "vm",
-		Image:           image.New(o.BaseImageDir, libvirtConn),
-		VM:              vm.New(libvirtConn),
-	}, nil
+		ConfigImagePool: o.ConfigImagePool,
+		BaseImagePool:   o.BaseImagePool,
+		VMImagePool:     o.VMImagePool,
+		Image:           image.New(o.BaseImageDir, o.Pools, libvirtConn),
+		VM:              vm.New(libvirtConn, o.Address),
+		Network:         network.New(libvirtConn),
+	}
+}
+
+// VirshURI returns the libvirt connection URI for virsh which connects to the
+// same libvirtd as uri. Sockets below /run/user are session daemons.
+func VirshURI(uri string) (string, error) {
+	network, address, ok := strings.Cut(uri, ":")
+	if !ok {
+		return "", fmt.Errorf("invalid connection uri '%s'", uri)
+	}
+	switch network {
+	case "unix":
+		instance := "system"
+		if strings.HasPrefix(address, "/run/user/") {
+			instance = "session"
+		}
+		return fmt.Sprintf("qemu+unix:///%s?socket=%s", instance, address), nil
+	case "tcp":
+		return fmt.Sprintf("qemu+tcp://%s/system", address), nil
+	default:
+		return "", fmt.Errorf("unsupported network '%s' in connection uri '%s'", network, uri)
+	}
 }
 
 func connectLibvirt(uri string) (*libvirt.Libvirt, error) {
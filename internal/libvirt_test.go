@@ -0,0 +1,26 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_VirshURI(t *testing.T) {
+	is := is.New(t)
+
+	uri, err := VirshURI("unix:/var/run/libvirt/libvirt-sock")
+	is.NoErr(err)
+	is.Equal(uri, "qemu+unix:///system?socket=/var/run/libvirt/libvirt-sock")
+
+	uri, err = VirshURI("unix:/run/user/1000/libvirt/libvirt-sock")
+	is.NoErr(err)
+	is.Equal(uri, "qemu+unix:///session?socket=/run/user/1000/libvirt/libvirt-sock")
+
+	uri, err = VirshURI("tcp:lab1.example.com:16509")
+	is.NoErr(err)
+	is.Equal(uri, "qemu+tcp://lab1.example.com:16509/system")
+
+	_, err = VirshURI("lab1.example.com")
+	is.True(err != nil)
+}
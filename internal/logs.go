@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dvob/vu/internal/image"
+	"github.com/dvob/vu/internal/vm"
+)
+
+// LogOptions describes which part of the serial log of a VM is shown.
+type LogOptions struct {
+	// Follow keeps showing new output until the writer fails.
+	Follow bool
+	// SinceBoot only shows the output since the last boot.
+	SinceBoot bool
+	// Interval is the interval in which new output is read if Follow is
+	// set. Defaults to one second.
+	Interval time.Duration
+}
+
+// Logs writes the serial log of the VM to w. The log contains the output of
+// the boot and cloud-init.
+func (m *Manager) Logs(name string, w io.Writer, opts LogOptions) error {
+	state, err := m.VM.Get(name)
+	if err != nil {
+		return err
+	}
+	if state.SerialLog == "" {
+		return fmt.Errorf("vm '%s' has no serial log: only VMs created in a file based config pool have a serial log", name)
+	}
+	if opts.Interval == 0 {
+		opts.Interval = time.Second
+	}
+
+	buf := &bytes.Buffer{}
+	offset, err := m.Image.Download(state.SerialLog, buf, 0)
+	// the log is created on the first start
+	if err != nil && !errors.Is(err, image.ErrNotFound) {
+		return err
+	}
+	log := buf.Bytes()
+	if opts.SinceBoot {
+		log = vm.SinceBoot(log)
+	}
+	_, err = w.Write(log)
+	if err != nil {
+		return err
+	}
+
+	for opts.Follow {
+		time.Sleep(opts.Interval)
+		n, err := m.Image.Download(state.SerialLog, w, offset)
+		if err != nil && !errors.Is(err, image.ErrNotFound) {
+			return err
+		}
+		offset += n
+	}
+	return nil
+}
@@ -2,23 +2,59 @@ package internal
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/dvob/vu/internal/cloudinit"
 	"github.com/dvob/vu/internal/image"
+	"github.com/dvob/vu/internal/ipam"
+	"github.com/dvob/vu/internal/network"
 	"github.com/dvob/vu/internal/vm"
 )
 
 type Manager struct {
+	// URI identifies the hypervisor host in the files which are shared
+	// between hosts.
+	URI             string
 	ConfigImagePool string
 	BaseImagePool   string
 	VMImagePool     string
 	Image           image.Manager
 	VM              vm.Manager
+	Network         network.Manager
+	IPAM            *ipam.Store
+	// SSHConfigFile is the SSH config file with the entries of the VMs. If
+	// it is empty no SSH config is written.
+	SSHConfigFile string
+	// KnownHostsFile is the known hosts file with the host keys of the
+	// VMs. If it is empty the host keys are not recorded.
+	KnownHostsFile string
+	// Context is the name of the context, which qualifies the names of
+	// the VMs in the SSH config.
+	Context string
 }
 
-func (m *Manager) Create(name, baseImageName string, vmConfig *vm.Config, ciConfig *cloudinit.Config) error {
+// Create creates a new VM with an image cloned from the base image, the
+// cloud-init config ISO and the data disks.
+func (m *Manager) Create(name, baseImageName string, vmConfig *vm.Config, ciConfig *cloudinit.Config, disks ...DiskOptions) error {
+	err := vm.ValidateName(name)
+	if err != nil {
+		return err
+	}
+	// check before any images are created
+	_, err = m.VM.Get(name)
+	if err == nil {
+		return &vm.Error{Name: name, Kind: vm.ErrAlreadyExists}
+	}
+	if !errors.Is(err, vm.ErrNotFound) {
+		return err
+	}
+
 	baseImage, err := m.Image.Get(m.BaseImagePool, baseImageName)
 	if err != nil {
 		return fmt.Errorf("failed to get image: %w", err)
@@ -30,40 +66,358 @@ func (m *Manager) Create(name, baseImageName string, vmConfig *vm.Config, ciConf
 	}
 	vmConfig.Image = image.ID
 
+	// try to cleanup the created images on errors
+	created := []string{image.ID}
+	cleanup := func() {
+		for _, id := range created {
+			_ = m.Image.Remove(id)
+		}
+	}
+
+	err = m.addMounts(vmConfig.Mounts, ciConfig)
+	if err != nil {
+		cleanup()
+		return err
+	}
+
 	isoConfig, err := ciConfig.ISO()
 	if err != nil {
+		cleanup()
 		return fmt.Errorf("failed to create config ISO: %w", err)
 	}
 
 	reader := io.NopCloser(bytes.NewBuffer(isoConfig))
 
-	isoImage, err := m.Image.Create(m.ConfigImagePool, name, reader)
+	isoImage, err := m.Image.Create(m.ConfigImagePool, name, reader, uint64(len(isoConfig)))
 	if err != nil {
-		// try to cleanup cloned base image
-		_ = m.Image.Remove(image.ID)
+		cleanup()
 		return fmt.Errorf("failed to store config ISO: %w", err)
 	}
 	vmConfig.ISO = isoImage.ID
+	created = append(created, isoImage.ID)
+
+	// the log is created by libvirt when the VM starts
+	vmConfig.SerialLog, err = m.Image.Path(m.ConfigImagePool, name+".log")
+	if err != nil {
+		cleanup()
+		return fmt.Errorf("failed to get location of serial log: %w", err)
+	}
+
+	vmConfig.Disks = []vm.Disk{}
+	for _, opts := range disks {
+		disk, err := m.createDisk(name, opts)
+		if err != nil {
+			cleanup()
+			return err
+		}
+		vmConfig.Disks = append(vmConfig.Disks, *disk)
+		created = append(created, disk.Image)
+	}
 
 	err = m.VM.Create(name, vmConfig)
 	if err != nil {
+		// the log may exist if the VM failed to start
+		if vmConfig.SerialLog != "" {
+			created = append(created, vmConfig.SerialLog)
+		}
+		cleanup()
 		return err
 	}
 	return nil
 }
 
-func (m *Manager) Remove(name string) error {
-	state, err := m.VM.Get(name)
+// addMounts adds the shared directories to the cloud-init configuration, so
+// that they are mounted at /mnt/TAG in the VM.
+func (m *Manager) addMounts(mounts []vm.Mount, ciConfig *cloudinit.Config) error {
+	if len(mounts) == 0 {
+		return nil
+	}
+	mountType, err := m.VM.MountType()
+	if err != nil {
+		return fmt.Errorf("failed to get mount type: %w", err)
+	}
+	if ciConfig.UserData == nil {
+		ciConfig.UserData = &cloudinit.UserData{}
+	}
+	for _, mount := range mounts {
+		fsType := mount.Type(mountType)
+		// the VM boots even if the directory can not be mounted
+		options := []string{"defaults", "nofail"}
+		if fsType == vm.MountType9P {
+			options = append(options, "trans=virtio", "version=9p2000.L")
+		}
+		if mount.ReadOnly {
+			options = append(options, "ro")
+		}
+		ciConfig.UserData.AddMount(mount.Tag, path.Join("/mnt", mount.Tag), fsType, strings.Join(options, ","))
+	}
+	return nil
+}
+
+// Remove removes the VMs and all their images. Running VMs are shut down
+// gracefully first and stopped forcefully if they do not shut off within the
+// timeout.
+func (m *Manager) Remove(force bool, timeout time.Duration, names ...string) error {
+	states := []*vm.VM{}
+	running := []string{}
+	for _, name := range names {
+		state, err := m.VM.Get(name)
+		if err != nil {
+			return err
+		}
+		states = append(states, state)
+		if state.State == vm.StateRunning {
+			running = append(running, name)
+		}
+	}
+	err := m.Shutdown(ShutdownOptions{
+		Force:      force,
+		Wait:       true,
+		Timeout:    timeout,
+		ForceAfter: true,
+	}, running...)
 	if err != nil {
 		return err
 	}
 
-	for _, imageID := range state.Images {
+	for _, state := range states {
+		err := m.remove(state)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove removes the stopped VM and all its images.
+func (m *Manager) remove(state *vm.VM) error {
+	name := state.Name
+	images := state.Images
+	if state.SerialLog != "" {
+		images = append(images, state.SerialLog)
+	}
+	for _, imageID := range images {
 		err := m.Image.Remove(imageID)
+		if err != nil && !errors.Is(err, image.ErrNotFound) {
+			return err
+		}
+	}
+
+	err := m.VM.Remove(name)
+	if err != nil {
+		return err
+	}
+	err = m.ReleaseAddresses(name)
+	if err != nil {
+		return err
+	}
+	err = m.RemoveKnownHost(name)
+	if err != nil {
+		return err
+	}
+	return m.RemoveSSHConfig(name)
+}
+
+// Reservations records the addresses and DHCP hosts which are added for a
+// new VM. If the creation fails only these are released and not the ones of
+// an existing VM with the same name.
+type Reservations struct {
+	allocations []ipam.Allocation
+	hosts       []networkHost
+}
+
+type networkHost struct {
+	network string
+	host    network.Host
+}
+
+// AllocateAddress allocates a free IPv4 address in the subnet of the network
+// for the VM. The gateway, the DHCP range and the addresses of active DHCP
+// leases are skipped. It returns the address in CIDR notation and the
+// gateway of the network.
+func (m *Manager) AllocateAddress(networkName, vmName string, r *Reservations) (string, string, error) {
+	n, subnet, err := m.networkSubnet(networkName)
+	if err != nil {
+		return "", "", err
+	}
+	if subnet == nil {
+		return "", "", fmt.Errorf("network '%s' has no IPv4 subnet to allocate an address from", networkName)
+	}
+
+	leases, err := m.Network.Leases(networkName)
+	if err != nil {
+		return "", "", err
+	}
+	leased := map[string]bool{}
+	for _, lease := range leases {
+		leased[lease.IP] = true
+	}
+	for _, host := range n.Hosts {
+		leased[host.IP] = true
+	}
+
+	gateway := net.ParseIP(n.Gateway)
+	used := func(ip net.IP) bool {
+		return ip.Equal(gateway) || n.InDHCPRange(ip) || leased[ip.String()]
+	}
+	ip, err := m.IPAM.Allocate(networkName, vmName, subnet, used)
+	if err != nil {
+		return "", "", err
+	}
+	r.allocations = append(r.allocations, ipam.Allocation{Network: networkName, VM: vmName, Address: ip.String()})
+	prefix, _ := subnet.Mask.Size()
+	return fmt.Sprintf("%s/%d", ip, prefix), n.Gateway, nil
+}
+
+// ReserveAddress records a static address of a VM, so that it is not
+// allocated to another VM. Addresses outside of the IPv4 subnet of the network
+// are not recorded.
+func (m *Manager) ReserveAddress(networkName, vmName, address string, r *Reservations) error {
+	ip, _, err := net.ParseCIDR(address)
+	if err != nil {
+		return err
+	}
+	_, subnet, err := m.networkSubnet(networkName)
+	if err != nil {
+		return err
+	}
+	if subnet == nil || !subnet.Contains(ip) {
+		return nil
+	}
+	added, err := m.IPAM.Reserve(networkName, vmName, ip)
+	if err != nil {
+		return err
+	}
+	if added {
+		r.allocations = append(r.allocations, ipam.Allocation{Network: networkName, VM: vmName, Address: ip.String()})
+	}
+	return nil
+}
+
+// AddDHCPHost adds a DHCP reservation for the interface of the VM with the
+// MAC address to the network.
+func (m *Manager) AddDHCPHost(networkName, vmName, mac, ip string, r *Reservations) error {
+	host := network.Host{
+		MAC:  mac,
+		IP:   ip,
+		Name: vmName,
+	}
+	err := m.Network.AddHost(networkName, host)
+	if err != nil {
+		return err
+	}
+	r.hosts = append(r.hosts, networkHost{network: networkName, host: host})
+	return nil
+}
+
+// ReleaseReservations removes the DHCP hosts and releases the addresses which
+// were recorded in r.
+func (m *Manager) ReleaseReservations(r *Reservations) error {
+	for _, h := range r.hosts {
+		err := m.Network.RemoveHost(h.network, h.host)
 		if err != nil {
 			return err
 		}
 	}
+	if len(r.allocations) == 0 {
+		return nil
+	}
+	return m.IPAM.Remove(r.allocations...)
+}
 
-	return m.VM.Remove(name)
+// ReleaseAddresses releases all addresses of the VM and removes its DHCP
+// reservations from all networks.
+func (m *Manager) ReleaseAddresses(vmName string) error {
+	networks, err := m.Network.List()
+	if err != nil {
+		return err
+	}
+	for _, n := range networks {
+		for _, host := range n.Hosts {
+			if host.Name != vmName {
+				continue
+			}
+			err := m.Network.RemoveHost(n.Name, host)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return m.IPAM.Release(vmName)
+}
+
+func (m *Manager) networkSubnet(name string) (*network.Network, *net.IPNet, error) {
+	n, err := m.Network.Get(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n.Subnet == "" {
+		return n, nil, nil
+	}
+	_, subnet, err := net.ParseCIDR(n.Subnet)
+	return n, subnet, err
+}
+
+// NetworkVMs returns the names of the VMs attached to each network.
+func (m *Manager) NetworkVMs() (map[string][]string, error) {
+	vms, err := m.VM.List()
+	if err != nil {
+		return nil, err
+	}
+	attached := map[string][]string{}
+	for _, vm := range vms {
+		for _, iface := range vm.Interfaces {
+			if contains(attached[iface.Network], vm.Name) {
+				continue
+			}
+			attached[iface.Network] = append(attached[iface.Network], vm.Name)
+		}
+	}
+	return attached, nil
+}
+
+// RemoveNetwork removes a network if no VMs are attached to it.
+func (m *Manager) RemoveNetwork(name string) error {
+	attached, err := m.NetworkVMs()
+	if err != nil {
+		return err
+	}
+	if vms := attached[name]; len(vms) > 0 {
+		return &network.Error{
+			Name: name,
+			Kind: network.ErrInUse,
+			Err:  fmt.Errorf("used by %s", strings.Join(vms, ", ")),
+		}
+	}
+	return m.Network.Remove(name)
+}
+
+// RemoveImage removes an image if no other images use it as backing store.
+func (m *Manager) RemoveImage(pool, name string) error {
+	img, err := m.Image.Get(pool, name)
+	if err != nil {
+		return err
+	}
+	users, err := m.Image.Users(img.ID)
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return &image.Error{
+			Pool: pool,
+			Name: name,
+			Kind: image.ErrInUse,
+			Err:  fmt.Errorf("used as backing store by %s", strings.Join(users, ", ")),
+		}
+	}
+	return m.Image.Remove(img.ID)
+}
+
+func contains(strs []string, str string) bool {
+	for _, entry := range strs {
+		if entry == str {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,43 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned if a network does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is returned if a network with the same name exists
+	// already.
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrInUse is returned if a network can not be removed since VMs are
+	// attached to it.
+	ErrInUse = errors.New("is in use")
+)
+
+// Error is returned by the backends to describe a failed operation on a
+// network. Kind is one of the sentinel errors of this package and Err the
+// optional underlying error.
+type Error struct {
+	Name string
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("network '%s' %s", e.Name, e.Kind)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is reports whether target is the kind of the error.
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,315 @@
+package libvirt
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/dvob/vu/internal/network"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+var _ network.Manager = &Manager{}
+
+type Manager struct {
+	*libvirt.Libvirt
+}
+
+func New(libvirt *libvirt.Libvirt) *Manager {
+	return &Manager{
+		libvirt,
+	}
+}
+
+// mapError maps libvirt errors to the errors of the network package.
+func mapError(name string, err error) error {
+	var libvirtErr libvirt.Error
+	if !errors.As(err, &libvirtErr) {
+		return err
+	}
+	switch libvirt.ErrorNumber(libvirtErr.Code) {
+	case libvirt.ErrNoNetwork:
+		return &network.Error{Name: name, Kind: network.ErrNotFound}
+	case libvirt.ErrNetworkExist:
+		return &network.Error{Name: name, Kind: network.ErrAlreadyExists}
+	default:
+		return err
+	}
+}
+
+func (m *Manager) lookup(name string) (libvirt.Network, error) {
+	nw, err := m.NetworkLookupByName(name)
+	return nw, mapError(name, err)
+}
+
+// Create defines and starts a persistent network which is started
+// automatically.
+func (m *Manager) Create(n *network.Network) error {
+	_, err := m.lookup(n.Name)
+	if err == nil {
+		return &network.Error{Name: n.Name, Kind: network.ErrAlreadyExists}
+	}
+	if !errors.Is(err, network.ErrNotFound) {
+		return err
+	}
+
+	xml, err := networkXML(n)
+	if err != nil {
+		return err
+	}
+
+	nw, err := m.NetworkDefineXML(xml)
+	if err != nil {
+		return fmt.Errorf("failed to define network: %w", mapError(n.Name, err))
+	}
+
+	err = m.NetworkCreate(nw)
+	if err != nil {
+		_ = m.NetworkUndefine(nw)
+		return fmt.Errorf("failed to start network '%s': %w", n.Name, err)
+	}
+
+	err = m.NetworkSetAutostart(nw, 1)
+	if err != nil {
+		return fmt.Errorf("failed to enable autostart for network '%s': %w", n.Name, err)
+	}
+	return nil
+}
+
+func networkXML(n *network.Network) (string, error) {
+	_, subnet, err := net.ParseCIDR(n.Subnet)
+	if err != nil {
+		return "", err
+	}
+	prefix, _ := subnet.Mask.Size()
+
+	netDef := &libvirtxml.Network{
+		Name: n.Name,
+		Bridge: &libvirtxml.NetworkBridge{
+			STP:   "on",
+			Delay: "0",
+		},
+		IPs: []libvirtxml.NetworkIP{
+			{
+				Address: n.Gateway,
+				Prefix:  uint(prefix),
+			},
+		},
+	}
+	if n.Mode != network.ModeIsolated {
+		netDef.Forward = &libvirtxml.NetworkForward{
+			Mode: n.Mode,
+		}
+	}
+	if n.Domain != "" {
+		netDef.Domain = &libvirtxml.NetworkDomain{
+			Name:      n.Domain,
+			LocalOnly: "yes",
+		}
+	}
+	if n.DHCPStart != "" {
+		netDef.IPs[0].DHCP = &libvirtxml.NetworkDHCP{
+			Ranges: []libvirtxml.NetworkDHCPRange{
+				{
+					Start: n.DHCPStart,
+					End:   n.DHCPEnd,
+				},
+			},
+		}
+	}
+	return netDef.Marshal()
+}
+
+func (m *Manager) List() ([]network.Network, error) {
+	nws, _, err := m.ConnectListAllNetworks(1, 0)
+	if err != nil {
+		return nil, err
+	}
+	networks := []network.Network{}
+	for _, nw := range nws {
+		n, err := m.get(nw)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, *n)
+	}
+	return networks, nil
+}
+
+func (m *Manager) Get(name string) (*network.Network, error) {
+	nw, err := m.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return m.get(nw)
+}
+
+func (m *Manager) get(nw libvirt.Network) (*network.Network, error) {
+	xml, err := m.NetworkGetXMLDesc(nw, 0)
+	if err != nil {
+		return nil, mapError(nw.Name, err)
+	}
+	netDef := &libvirtxml.Network{}
+	err = netDef.Unmarshal(xml)
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := m.NetworkIsActive(nw)
+	if err != nil {
+		return nil, mapError(nw.Name, err)
+	}
+
+	n := &network.Network{
+		Name:   nw.Name,
+		Mode:   network.ModeIsolated,
+		Active: active == 1,
+	}
+	if netDef.Forward != nil {
+		n.Mode = netDef.Forward.Mode
+		// libvirt uses nat if the mode is not set
+		if n.Mode == "" {
+			n.Mode = network.ModeNAT
+		}
+	}
+	if netDef.Bridge != nil {
+		n.Bridge = netDef.Bridge.Name
+	}
+	if netDef.Domain != nil {
+		n.Domain = netDef.Domain.Name
+	}
+	setIPv4(n, netDef.IPs)
+	return n, nil
+}
+
+// setIPv4 sets the subnet, the gateway and the DHCP range of the network from
+// the first IPv4 address of the network definition.
+func setIPv4(n *network.Network, ips []libvirtxml.NetworkIP) {
+	for _, ip := range ips {
+		if ip.Family != "" && ip.Family != "ipv4" {
+			continue
+		}
+		address := net.ParseIP(ip.Address)
+		if address == nil {
+			continue
+		}
+		mask := net.CIDRMask(int(ip.Prefix), 32)
+		if ip.Netmask != "" {
+			mask = net.IPMask(net.ParseIP(ip.Netmask).To4())
+		}
+		subnet := &net.IPNet{
+			IP:   address.Mask(mask),
+			Mask: mask,
+		}
+		n.Subnet = subnet.String()
+		n.Gateway = ip.Address
+		if ip.DHCP == nil {
+			return
+		}
+		if len(ip.DHCP.Ranges) > 0 {
+			n.DHCPStart = ip.DHCP.Ranges[0].Start
+			n.DHCPEnd = ip.DHCP.Ranges[0].End
+		}
+		for _, host := range ip.DHCP.Hosts {
+			n.Hosts = append(n.Hosts, network.Host{
+				MAC:  host.MAC,
+				IP:   host.IP,
+				Name: host.Name,
+			})
+		}
+		return
+	}
+}
+
+// Remove stops and removes the network.
+func (m *Manager) Remove(name string) error {
+	nw, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	active, err := m.NetworkIsActive(nw)
+	if err != nil {
+		return mapError(name, err)
+	}
+	if active == 1 {
+		err = m.NetworkDestroy(nw)
+		if err != nil {
+			return mapError(name, err)
+		}
+	}
+
+	return mapError(name, m.NetworkUndefine(nw))
+}
+
+// Leases returns the active DHCP leases of the network.
+func (m *Manager) Leases(name string) ([]network.Lease, error) {
+	nw, err := m.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	dhcpLeases, _, err := m.NetworkGetDhcpLeases(nw, nil, 1, 0)
+	if err != nil {
+		return nil, mapError(name, err)
+	}
+	leases := []network.Lease{}
+	for _, l := range dhcpLeases {
+		lease := network.Lease{
+			IP: l.Ipaddr,
+		}
+		if len(l.Mac) > 0 {
+			lease.MAC = l.Mac[0]
+		}
+		if len(l.Hostname) > 0 {
+			lease.Hostname = l.Hostname[0]
+		}
+		leases = append(leases, lease)
+	}
+	return leases, nil
+}
+
+// AddHost adds a DHCP reservation to the network. The reservation is added to
+// the running network and to its persistent configuration.
+func (m *Manager) AddHost(name string, host network.Host) error {
+	return m.updateHost(name, libvirt.NetworkUpdateCommandAddLast, host)
+}
+
+// RemoveHost removes a DHCP reservation from the network.
+func (m *Manager) RemoveHost(name string, host network.Host) error {
+	return m.updateHost(name, libvirt.NetworkUpdateCommandDelete, host)
+}
+
+func (m *Manager) updateHost(name string, command libvirt.NetworkUpdateCommand, host network.Host) error {
+	nw, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	hostXML, err := xml.Marshal(&libvirtxml.NetworkDHCPHost{
+		MAC:  host.MAC,
+		IP:   host.IP,
+		Name: host.Name,
+	})
+	if err != nil {
+		return err
+	}
+
+	flags := libvirt.NetworkUpdateAffectConfig
+	active, err := m.NetworkIsActive(nw)
+	if err != nil {
+		return mapError(name, err)
+	}
+	if active == 1 {
+		flags |= libvirt.NetworkUpdateAffectLive
+	}
+
+	// with the parent index -1 libvirt selects the IP definition which
+	// contains the address of the host
+	err = m.NetworkUpdateCompat(nw, command, libvirt.NetworkSectionIPDhcpHost, -1, string(hostXML), flags)
+	if err != nil {
+		return fmt.Errorf("failed to update DHCP host %s (%s) in network '%s': %w", host.MAC, host.IP, name, mapError(name, err))
+	}
+	return nil
+}
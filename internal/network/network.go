@@ -0,0 +1,162 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// Modes of a network.
+const (
+	// ModeNAT connects the network to the outside using NAT.
+	ModeNAT = "nat"
+	// ModeIsolated networks are only reachable from the host and the VMs in
+	// the network.
+	ModeIsolated = "isolated"
+	// ModeRoute routes the traffic of the network to the outside without
+	// NAT.
+	ModeRoute = "route"
+)
+
+type Manager interface {
+	Create(network *Network) error
+	List() ([]Network, error)
+	Get(name string) (*Network, error)
+	Remove(name string) error
+	Leases(name string) ([]Lease, error)
+	AddHost(network string, host Host) error
+	RemoveHost(network string, host Host) error
+}
+
+// Host is a DHCP reservation which assigns a fixed address to the interface
+// with the MAC address.
+type Host struct {
+	MAC  string
+	IP   string
+	Name string
+}
+
+// Lease is an active DHCP lease in a network.
+type Lease struct {
+	MAC      string
+	IP       string
+	Hostname string
+}
+
+// Network describes a virtual network. Subnet is an IPv4 network in CIDR
+// notation and Gateway the address of the host in this network. If DHCPStart
+// and DHCPEnd are empty DHCP is disabled. Hosts are the DHCP reservations.
+type Network struct {
+	Name      string
+	Mode      string
+	Bridge    string
+	Subnet    string
+	Gateway   string
+	DHCPStart string
+	DHCPEnd   string
+	Domain    string
+	Active    bool
+	Hosts     []Host
+}
+
+// Complete validates the network and sets the gateway to the first address
+// of the subnet if it is not set.
+func (n *Network) Complete() error {
+	switch n.Mode {
+	case ModeNAT, ModeIsolated, ModeRoute:
+	default:
+		return fmt.Errorf("invalid mode '%s': use %s, %s or %s", n.Mode, ModeNAT, ModeIsolated, ModeRoute)
+	}
+
+	subnet, err := ParseSubnet(n.Subnet)
+	if err != nil {
+		return err
+	}
+	n.Subnet = subnet.String()
+
+	if n.Gateway == "" {
+		n.Gateway = FirstIP(subnet).String()
+	}
+	if err := checkInSubnet(subnet, "gateway", n.Gateway); err != nil {
+		return err
+	}
+
+	if n.DHCPStart == "" && n.DHCPEnd == "" {
+		return nil
+	}
+	if err := checkInSubnet(subnet, "DHCP range start", n.DHCPStart); err != nil {
+		return err
+	}
+	if err := checkInSubnet(subnet, "DHCP range end", n.DHCPEnd); err != nil {
+		return err
+	}
+	if ipToInt(net.ParseIP(n.DHCPStart)) > ipToInt(net.ParseIP(n.DHCPEnd)) {
+		return fmt.Errorf("invalid DHCP range %s-%s", n.DHCPStart, n.DHCPEnd)
+	}
+	return nil
+}
+
+// InDHCPRange reports whether the address is part of the DHCP range.
+func (n *Network) InDHCPRange(ip net.IP) bool {
+	start, end := net.ParseIP(n.DHCPStart), net.ParseIP(n.DHCPEnd)
+	if start == nil || end == nil || ip.To4() == nil {
+		return false
+	}
+	return ipToInt(start) <= ipToInt(ip) && ipToInt(ip) <= ipToInt(end)
+}
+
+func checkInSubnet(subnet *net.IPNet, name, address string) error {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return fmt.Errorf("invalid %s '%s'", name, address)
+	}
+	if !subnet.Contains(ip) {
+		return fmt.Errorf("%s %s is not in subnet %s", name, address, subnet)
+	}
+	return nil
+}
+
+// ParseSubnet parses an IPv4 subnet in CIDR notation. The subnet has to
+// contain at least two usable addresses.
+func ParseSubnet(subnet string) (*net.IPNet, error) {
+	_, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return nil, err
+	}
+	if ipNet.IP.To4() == nil {
+		return nil, fmt.Errorf("subnet '%s' is not an IPv4 subnet", subnet)
+	}
+	if ones, _ := ipNet.Mask.Size(); ones > 30 {
+		return nil, fmt.Errorf("subnet '%s' is too small", subnet)
+	}
+	return ipNet, nil
+}
+
+// FirstIP returns the first usable address of an IPv4 subnet.
+func FirstIP(subnet *net.IPNet) net.IP {
+	return intToIP(ipToInt(subnet.IP) + 1)
+}
+
+// LastIP returns the last usable address of an IPv4 subnet.
+func LastIP(subnet *net.IPNet) net.IP {
+	ones, bits := subnet.Mask.Size()
+	return intToIP(ipToInt(subnet.IP) + 1<<(bits-ones) - 2)
+}
+
+// DefaultDHCPRange returns the upper half of the subnet as DHCP range. The
+// lower half remains for static addresses.
+func DefaultDHCPRange(subnet *net.IPNet) (net.IP, net.IP) {
+	ones, bits := subnet.Mask.Size()
+	start := intToIP(ipToInt(subnet.IP) + 1<<(bits-ones)/2)
+	return start, LastIP(subnet)
+}
+
+func ipToInt(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func intToIP(n uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, n)
+	return ip
+}
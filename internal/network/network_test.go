@@ -0,0 +1,39 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_DefaultDHCPRange(t *testing.T) {
+	is := is.New(t)
+
+	subnet, err := ParseSubnet("10.10.0.0/24")
+	is.NoErr(err)
+
+	start, end := DefaultDHCPRange(subnet)
+	is.Equal(start.String(), "10.10.0.128")
+	is.Equal(end.String(), "10.10.0.254")
+	is.Equal(FirstIP(subnet).String(), "10.10.0.1")
+}
+
+func Test_Network_Complete(t *testing.T) {
+	is := is.New(t)
+
+	n := &Network{
+		Mode:      ModeNAT,
+		Subnet:    "10.10.0.7/24",
+		DHCPStart: "10.10.0.100",
+		DHCPEnd:   "10.10.0.200",
+	}
+	is.NoErr(n.Complete())
+	is.Equal(n.Subnet, "10.10.0.0/24") // subnet normalized
+	is.Equal(n.Gateway, "10.10.0.1")   // first address as gateway
+
+	n.DHCPEnd = "10.10.1.200"
+	is.True(n.Complete() != nil) // DHCP range outside of subnet
+
+	n = &Network{Mode: "bridge", Subnet: "10.10.0.0/24"}
+	is.True(n.Complete() != nil) // invalid mode
+}
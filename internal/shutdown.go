@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dvob/vu/internal/vm"
+)
+
+// ShutdownOptions describes how a VM is shut down.
+type ShutdownOptions struct {
+	// Force stops the VM immediately instead of asking the guest to shut
+	// down.
+	Force bool
+	// Wait waits until the VM is shut off.
+	Wait bool
+	// Timeout is the maximum time to wait for the VM to shut off. If it is
+	// zero there is no limit.
+	Timeout time.Duration
+	// ForceAfter stops the VM forcefully if it did not shut off within the
+	// timeout instead of returning an error.
+	ForceAfter bool
+	// Interval is the interval in which the state of the VM is checked
+	// if Wait is set. Defaults to one second.
+	Interval time.Duration
+}
+
+// Shutdown shuts down the VMs according to the options. All VMs are asked to
+// shut down first, so that they shut down in parallel and the timeout applies
+// to all of them together.
+func (m *Manager) Shutdown(opts ShutdownOptions, names ...string) error {
+	pending := []string{}
+	for _, name := range names {
+		err := m.VM.Shutdown(name, opts.Force)
+		if errors.Is(err, vm.ErrInvalidState) && opts.Wait {
+			// the VM is already shut off
+			err = m.checkShutoff(name, err)
+			if err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			return err
+		}
+		pending = append(pending, name)
+	}
+	if opts.Force || !opts.Wait {
+		return nil
+	}
+	if opts.Interval == 0 {
+		opts.Interval = time.Second
+	}
+
+	var deadline time.Time
+	if opts.Timeout != 0 {
+		deadline = time.Now().Add(opts.Timeout)
+	}
+	for {
+		running := []string{}
+		for _, name := range pending {
+			state, err := m.VM.Get(name)
+			if err != nil {
+				return err
+			}
+			if state.State != vm.StateShutoff {
+				running = append(running, name)
+			}
+		}
+		pending = running
+		if len(pending) == 0 {
+			return nil
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(opts.Interval)
+	}
+
+	if !opts.ForceAfter {
+		if len(pending) == 1 {
+			return fmt.Errorf("vm '%s' did not shut down within %s", pending[0], opts.Timeout)
+		}
+		return fmt.Errorf("vms '%s' did not shut down within %s", strings.Join(pending, "', '"), opts.Timeout)
+	}
+	for _, name := range pending {
+		err := m.VM.Shutdown(name, true)
+		// the VM may have shut off since the last check
+		if errors.Is(err, vm.ErrInvalidState) {
+			err = m.checkShutoff(name, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkShutoff returns nil if the VM is shut off and err otherwise.
+func (m *Manager) checkShutoff(name string, err error) error {
+	state, getErr := m.VM.Get(name)
+	if getErr != nil || state.State != vm.StateShutoff {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dvob/vu/internal/vm"
+	"github.com/matryer/is"
+)
+
+// fakeVMs is a vm.Manager which only implements Shutdown and Get. A VM shuts
+// off after the number of checks in shutoffAfter or never if it is missing.
+type fakeVMs struct {
+	vm.Manager
+	states       map[string]string
+	shutoffAfter map[string]int
+	calls        []string
+}
+
+func (f *fakeVMs) Shutdown(name string, force bool) error {
+	if force {
+		f.calls = append(f.calls, "destroy "+name)
+	} else {
+		f.calls = append(f.calls, "shutdown "+name)
+	}
+	if f.states[name] != vm.StateRunning {
+		return &vm.Error{Name: name, Kind: vm.ErrInvalidState}
+	}
+	if force {
+		f.states[name] = vm.StateShutoff
+	}
+	return nil
+}
+
+func (f *fakeVMs) Get(name string) (*vm.VM, error) {
+	f.calls = append(f.calls, "get "+name)
+	if after, ok := f.shutoffAfter[name]; ok {
+		if after == 0 {
+			f.states[name] = vm.StateShutoff
+		}
+		f.shutoffAfter[name] = after - 1
+	}
+	return &vm.VM{Name: name, State: f.states[name]}, nil
+}
+
+func newFakeVMs(names ...string) *fakeVMs {
+	f := &fakeVMs{
+		states:       map[string]string{},
+		shutoffAfter: map[string]int{},
+	}
+	for _, name := range names {
+		f.states[name] = vm.StateRunning
+	}
+	return f
+}
+
+func Test_Shutdown_Wait(t *testing.T) {
+	is := is.New(t)
+
+	fake := newFakeVMs("vm1", "vm2")
+	fake.shutoffAfter["vm1"] = 1
+	fake.shutoffAfter["vm2"] = 0
+	mgr := &Manager{VM: fake}
+
+	err := mgr.Shutdown(ShutdownOptions{Wait: true, Interval: time.Millisecond}, "vm1", "vm2")
+	is.NoErr(err)
+	is.Equal(fake.calls, []string{
+		// all VMs are asked to shut down before the first check
+		"shutdown vm1",
+		"shutdown vm2",
+		"get vm1",
+		"get vm2",
+		"get vm1",
+	})
+}
+
+func Test_Shutdown_Timeout(t *testing.T) {
+	is := is.New(t)
+
+	fake := newFakeVMs("vm1", "vm2")
+	fake.shutoffAfter["vm2"] = 0
+	mgr := &Manager{VM: fake}
+
+	opts := ShutdownOptions{
+		Wait:     true,
+		Timeout:  10 * time.Millisecond,
+		Interval: time.Millisecond,
+	}
+	err := mgr.Shutdown(opts, "vm1", "vm2")
+	is.True(err != nil) // vm1 does not shut down
+	is.Equal(fake.states["vm1"], vm.StateRunning)
+
+	fake = newFakeVMs("vm1", "vm2")
+	mgr = &Manager{VM: fake}
+	opts.ForceAfter = true
+	err = mgr.Shutdown(opts, "vm1", "vm2")
+	is.NoErr(err)
+	is.Equal(fake.states["vm1"], vm.StateShutoff)
+	is.Equal(fake.states["vm2"], vm.StateShutoff)
+}
+
+// raceVMs shuts off a VM between the last check and the forced stop.
+type raceVMs struct {
+	*fakeVMs
+}
+
+func (r *raceVMs) Shutdown(name string, force bool) error {
+	if force {
+		r.states[name] = vm.StateShutoff
+	}
+	return r.fakeVMs.Shutdown(name, force)
+}
+
+func Test_Shutdown_ForceAfterShutoff(t *testing.T) {
+	is := is.New(t)
+
+	fake := &raceVMs{newFakeVMs("vm1")}
+	mgr := &Manager{VM: fake}
+
+	err := mgr.Shutdown(ShutdownOptions{
+		Wait:       true,
+		Timeout:    time.Millisecond,
+		Interval:   time.Millisecond,
+		ForceAfter: true,
+	}, "vm1")
+	is.NoErr(err) // the VM is shut off anyway
+
+	// without waiting the caller learns that the VM was not running
+	err = mgr.Shutdown(ShutdownOptions{}, "vm1")
+	is.True(errors.Is(err, vm.ErrInvalidState))
+}
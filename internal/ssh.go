@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/dvob/vu/internal/sshconfig"
+	"github.com/dvob/vu/internal/vm"
+)
+
+// SSHHost is the user and the identity file which are used to connect to a
+// VM.
+type SSHHost struct {
+	User         string
+	IdentityFile string
+}
+
+// SetSSHConfig creates or replaces the SSH config entry of the VM.
+func (m *Manager) SetSSHConfig(name string, host SSHHost) error {
+	return m.updateSSHConfig(func(c *sshconfig.Config) error {
+		v, err := m.VM.Get(name)
+		if err != nil {
+			return err
+		}
+		h, err := m.sshHost(v, host)
+		if err != nil {
+			return err
+		}
+		c.Set(h)
+		return nil
+	})
+}
+
+// RefreshSSHConfig updates the addresses in the SSH config entries of the
+// VMs. For VMs without an entry, an entry with the default user and identity
+// file is created. Without names the entries of all VMs are updated and the
+// entries of VMs which no longer exist are removed.
+func (m *Manager) RefreshSSHConfig(defaults SSHHost, names ...string) error {
+	return m.updateSSHConfig(func(c *sshconfig.Config) error {
+		vms := []vm.VM{}
+		if len(names) == 0 {
+			all, err := m.VM.List()
+			if err != nil {
+				return err
+			}
+			vms = all
+
+			existing := map[string]bool{}
+			for _, v := range vms {
+				existing[v.Name] = true
+			}
+			for _, h := range c.Hosts {
+				if h.URI == m.URI && !existing[h.Name] {
+					c.Remove(h.URI, h.Name)
+				}
+			}
+		}
+		for _, name := range names {
+			v, err := m.VM.Get(name)
+			if err != nil {
+				return err
+			}
+			vms = append(vms, *v)
+		}
+
+		for i := range vms {
+			host := defaults
+			if existing := c.Get(m.URI, vms[i].Name); existing != nil {
+				host = SSHHost{
+					User:         existing.User,
+					IdentityFile: existing.IdentityFile,
+				}
+			}
+			h, err := m.sshHost(&vms[i], host)
+			if err != nil {
+				return err
+			}
+			c.Set(h)
+		}
+		return nil
+	})
+}
+
+// RemoveSSHConfig removes the SSH config entry of the VM.
+func (m *Manager) RemoveSSHConfig(name string) error {
+	return m.updateSSHConfig(func(c *sshconfig.Config) error {
+		c.Remove(m.URI, name)
+		return nil
+	})
+}
+
+func (m *Manager) updateSSHConfig(fn func(*sshconfig.Config) error) error {
+	if m.SSHConfigFile == "" {
+		return nil
+	}
+	err := sshconfig.Update(m.SSHConfigFile, fn)
+	if err != nil {
+		return fmt.Errorf("failed to update ssh config: %w", err)
+	}
+	return nil
+}
+
+// sshHost returns the SSH config entry for the VM. If the host key of the VM
+// is known, the host key is checked against the known hosts file of vu.
+// Otherwise the host key is not checked since VMs with the same name are
+// recreated with new host keys.
+func (m *Manager) sshHost(v *vm.VM, host SSHHost) (sshconfig.Host, error) {
+	h := sshconfig.Host{
+		Name:                  v.Name,
+		URI:                   m.URI,
+		Context:               m.Context,
+		HostName:              m.address(v),
+		User:                  host.User,
+		IdentityFile:          host.IdentityFile,
+		StrictHostKeyChecking: "no",
+		UserKnownHostsFile:    "/dev/null",
+	}
+	if m.KnownHostsFile == "" {
+		return h, nil
+	}
+	key, err := sshconfig.KnownHost(m.KnownHostsFile, h.Alias())
+	if err != nil {
+		return h, err
+	}
+	if key != "" {
+		h.HostKeyAlias = h.Alias()
+		h.StrictHostKeyChecking = "yes"
+		h.UserKnownHostsFile = m.KnownHostsFile
+	}
+	return h, nil
+}
+
+// SetKnownHost records the public host key of the VM. The key is recorded
+// for the name qualified with the context, since VMs in other contexts can
+// have the same name.
+func (m *Manager) SetKnownHost(name, publicKey string) error {
+	if m.KnownHostsFile == "" {
+		return nil
+	}
+	return sshconfig.SetKnownHost(m.KnownHostsFile, m.hostAlias(name), publicKey)
+}
+
+// RemoveKnownHost removes the host key of the VM.
+func (m *Manager) RemoveKnownHost(name string) error {
+	if m.KnownHostsFile == "" {
+		return nil
+	}
+	return sshconfig.RemoveKnownHost(m.KnownHostsFile, m.hostAlias(name))
+}
+
+func (m *Manager) hostAlias(name string) string {
+	h := sshconfig.Host{
+		Name:    name,
+		Context: m.Context,
+	}
+	return h.Alias()
+}
+
+// address returns the IP address of the VM. If the VM did not report an
+// address yet (e.g. while it boots), the address allocated by vu or the
+// address of an existing DHCP lease of one of its interfaces is used. If no
+// address is known, an empty string is returned.
+func (m *Manager) address(v *vm.VM) string {
+	if v.IPAddress != "" && v.IPAddress != "n/a" {
+		return v.IPAddress
+	}
+
+	if m.IPAM != nil {
+		allocations, err := m.IPAM.List()
+		if err == nil {
+			for _, alloc := range allocations {
+				if alloc.VM == v.Name {
+					return alloc.Address
+				}
+			}
+		}
+	}
+
+	for _, iface := range v.Interfaces {
+		leases, err := m.Network.Leases(iface.Network)
+		if err != nil {
+			continue
+		}
+		for _, lease := range leases {
+			if lease.MAC == iface.MAC {
+				return lease.IP
+			}
+		}
+	}
+	return ""
+}
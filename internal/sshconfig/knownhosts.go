@@ -0,0 +1,121 @@
+package sshconfig
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HostKey is an SSH host key in the OpenSSH formats.
+type HostKey struct {
+	// Private is the private key in the OpenSSH PEM format.
+	Private string
+	// Public is the public key in the authorized keys format.
+	Public string
+}
+
+// GenerateHostKey generates a new ed25519 host key.
+func GenerateHostKey(comment string) (*HostKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	privBlock, err := ssh.MarshalPrivateKey(priv, comment)
+	if err != nil {
+		return nil, err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return &HostKey{
+		Private: string(pem.EncodeToMemory(privBlock)),
+		Public:  strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))),
+	}, nil
+}
+
+// DefaultKnownHostsFile returns the location of the known hosts file with the
+// host keys of the VMs.
+func DefaultKnownHostsFile() (string, error) {
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve known hosts file: %w", err)
+	}
+	return filepath.Join(userHome, ".config", "vu", "known_hosts"), nil
+}
+
+// KnownHost returns the public key of the host from the known hosts file. If
+// the host is unknown an empty string is returned.
+func KnownHost(file, name string) (string, error) {
+	lines, err := readKnownHosts(file)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range lines {
+		host, key, _ := strings.Cut(line, " ")
+		if host == name {
+			return key, nil
+		}
+	}
+	return "", nil
+}
+
+// SetKnownHost adds the public key of the host to the known hosts file and
+// replaces existing keys of the host.
+func SetKnownHost(file, name, publicKey string) error {
+	return updateKnownHosts(file, name, name+" "+publicKey)
+}
+
+// RemoveKnownHost removes the keys of the host from the known hosts file.
+func RemoveKnownHost(file, name string) error {
+	return updateKnownHosts(file, name, "")
+}
+
+func updateKnownHosts(file, name, newLine string) error {
+	return withLock(file, func() error {
+		lines, err := readKnownHosts(file)
+		if err != nil {
+			return err
+		}
+		buf := &bytes.Buffer{}
+		for _, line := range lines {
+			host, _, _ := strings.Cut(line, " ")
+			if host == name {
+				continue
+			}
+			fmt.Fprintln(buf, line)
+		}
+		if newLine != "" {
+			fmt.Fprintln(buf, newLine)
+		}
+		return writeFile(file, buf.Bytes())
+	})
+}
+
+func readKnownHosts(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
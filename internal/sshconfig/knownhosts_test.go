@@ -0,0 +1,49 @@
+package sshconfig
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+	"golang.org/x/crypto/ssh"
+)
+
+func Test_GenerateHostKey(t *testing.T) {
+	is := is.New(t)
+
+	key, err := GenerateHostKey("vm1")
+	is.NoErr(err)
+
+	signer, err := ssh.ParsePrivateKey([]byte(key.Private))
+	is.NoErr(err)
+	is.Equal(string(ssh.MarshalAuthorizedKey(signer.PublicKey())), key.Public+"\n") // public key matches private key
+}
+
+func Test_KnownHosts(t *testing.T) {
+	is := is.New(t)
+
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	is.NoErr(SetKnownHost(file, "vm1", "ssh-ed25519 AAAA1"))
+	is.NoErr(SetKnownHost(file, "vm2", "ssh-ed25519 AAAA2"))
+	is.NoErr(SetKnownHost(file, "vm1", "ssh-ed25519 AAAA3"))
+
+	key, err := KnownHost(file, "vm1")
+	is.NoErr(err)
+	is.Equal(key, "ssh-ed25519 AAAA3") // key replaced
+
+	is.NoErr(RemoveKnownHost(file, "vm1"))
+	key, err = KnownHost(file, "vm1")
+	is.NoErr(err)
+	is.Equal(key, "")
+
+	key, err = KnownHost(file, "vm2")
+	is.NoErr(err)
+	is.Equal(key, "ssh-ed25519 AAAA2")
+
+	// VMs with the same name in different contexts have their own keys
+	is.NoErr(SetKnownHost(file, "vm3.a", "ssh-ed25519 AAAA4"))
+	is.NoErr(SetKnownHost(file, "vm3.b", "ssh-ed25519 AAAA5"))
+	key, err = KnownHost(file, "vm3.a")
+	is.NoErr(err)
+	is.Equal(key, "ssh-ed25519 AAAA4")
+}
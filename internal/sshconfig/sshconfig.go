@@ -0,0 +1,301 @@
+// Package sshconfig manages an SSH client configuration file with one Host
+// entry per VM. The file is owned by vu and is included in the SSH
+// configuration of the user (~/.ssh/config) with an Include directive.
+//
+// Each entry matches the name of the VM qualified with its context (e.g.
+// vm1.lab1) and, if no VM of another context has the same name, the plain
+// name of the VM.
+package sshconfig
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dvob/vu/internal/filelock"
+)
+
+const (
+	header = "# Managed by vu. Changes are overwritten.\n"
+
+	// uriComment and contextComment precede each host entry and record the
+	// hypervisor host and the context of the VM.
+	uriComment     = "# vu-uri "
+	contextComment = "# vu-context "
+)
+
+// Host is the SSH configuration of a VM. Empty values are omitted.
+type Host struct {
+	Name                  string
+	URI                   string
+	Context               string
+	HostName              string
+	User                  string
+	IdentityFile          string
+	HostKeyAlias          string
+	StrictHostKeyChecking string
+	UserKnownHostsFile    string
+}
+
+// Config is the content of the SSH configuration file.
+type Config struct {
+	Hosts []Host
+}
+
+// DefaultFile returns the location of the default SSH configuration file.
+func DefaultFile() (string, error) {
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve ssh config file: %w", err)
+	}
+	return filepath.Join(userHome, ".ssh", "config.d", "vu"), nil
+}
+
+// Load reads the configuration from file. If the file does not exist an
+// empty configuration is returned.
+func Load(file string) (*Config, error) {
+	c := &Config{}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		uri     string
+		context string
+		current *Host
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, uriComment) {
+			uri = strings.TrimPrefix(line, uriComment)
+			continue
+		}
+		if strings.HasPrefix(line, contextComment) {
+			context = strings.TrimPrefix(line, contextComment)
+			continue
+		}
+		key, value, ok := strings.Cut(line, " ")
+		if line == "" || strings.HasPrefix(line, "#") || !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if key == "Host" {
+			// the first pattern is the qualified name
+			pattern := strings.Fields(value)[0]
+			name := pattern
+			if context != "" {
+				name = strings.TrimSuffix(pattern, "."+context)
+			}
+			c.Hosts = append(c.Hosts, Host{
+				Name:    name,
+				URI:     uri,
+				Context: context,
+			})
+			current = &c.Hosts[len(c.Hosts)-1]
+			uri = ""
+			context = ""
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		switch key {
+		case "HostName":
+			current.HostName = value
+		case "User":
+			current.User = value
+		case "IdentityFile":
+			current.IdentityFile = value
+		case "HostKeyAlias":
+			current.HostKeyAlias = value
+		case "StrictHostKeyChecking":
+			current.StrictHostKeyChecking = value
+		case "UserKnownHostsFile":
+			current.UserKnownHostsFile = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", file, err)
+	}
+	return c, nil
+}
+
+// Alias returns the name of the VM qualified with its context, which is
+// unique across all entries.
+func (h *Host) Alias() string {
+	if h.Context == "" {
+		return h.Name
+	}
+	return h.Name + "." + h.Context
+}
+
+// Save writes the configuration to a temporary file first and then replaces
+// file, so that ssh never reads a partially written file.
+func (c *Config) Save(file string) error {
+	names := map[string]int{}
+	for _, h := range c.Hosts {
+		names[h.Name]++
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(header)
+	for _, h := range c.Hosts {
+		fmt.Fprintf(buf, "\n%s%s\n", uriComment, h.URI)
+		if h.Context != "" {
+			fmt.Fprintf(buf, "%s%s\n", contextComment, h.Context)
+		}
+		patterns := h.Alias()
+		// ssh uses the first matching entry, so the plain name is only
+		// used if it is unique
+		if h.Alias() != h.Name && names[h.Name] == 1 {
+			patterns += " " + h.Name
+		}
+		fmt.Fprintf(buf, "Host %s\n", patterns)
+		for _, option := range [][2]string{
+			{"HostName", h.HostName},
+			{"User", h.User},
+			{"IdentityFile", h.IdentityFile},
+			{"HostKeyAlias", h.HostKeyAlias},
+			{"StrictHostKeyChecking", h.StrictHostKeyChecking},
+			{"UserKnownHostsFile", h.UserKnownHostsFile},
+		} {
+			if option[1] != "" {
+				fmt.Fprintf(buf, "  %s %s\n", option[0], option[1])
+			}
+		}
+	}
+
+	err := os.MkdirAll(filepath.Dir(file), 0o700)
+	if err != nil {
+		return err
+	}
+	return writeFile(file, buf.Bytes())
+}
+
+// Update locks file, applies fn to the configuration and saves it if fn does
+// not fail.
+func Update(file string, fn func(*Config) error) error {
+	return withLock(file, func() error {
+		c, err := Load(file)
+		if err != nil {
+			return err
+		}
+		err = fn(c)
+		if err != nil {
+			return err
+		}
+		return c.Save(file)
+	})
+}
+
+// Get returns the entry of the VM on the hypervisor host with the URI or nil
+// if it does not exist.
+func (c *Config) Get(uri, name string) *Host {
+	for i := range c.Hosts {
+		if c.Hosts[i].URI == uri && c.Hosts[i].Name == name {
+			return &c.Hosts[i]
+		}
+	}
+	return nil
+}
+
+// Set adds the entry or replaces an existing entry of the same VM. Entries
+// with the same alias on other hypervisor hosts are removed, since the
+// context refers to another host now.
+func (c *Config) Set(host Host) {
+	hosts := []Host{}
+	for _, h := range c.Hosts {
+		if host.Context != "" && h.URI != host.URI && h.Alias() == host.Alias() {
+			continue
+		}
+		hosts = append(hosts, h)
+	}
+	c.Hosts = hosts
+	if existing := c.Get(host.URI, host.Name); existing != nil {
+		*existing = host
+		return
+	}
+	c.Hosts = append(c.Hosts, host)
+}
+
+// Remove removes the entry of the VM.
+func (c *Config) Remove(uri, name string) {
+	hosts := []Host{}
+	for _, h := range c.Hosts {
+		if h.URI == uri && h.Name == name {
+			continue
+		}
+		hosts = append(hosts, h)
+	}
+	c.Hosts = hosts
+}
+
+// Included reports whether file is included in the SSH configuration
+// userConfig with an Include directive. Relative paths are resolved relative
+// to the directory of userConfig.
+func Included(userConfig, file string) (bool, error) {
+	data, err := os.ReadFile(userConfig)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "Include") {
+			continue
+		}
+		for _, pattern := range fields[1:] {
+			if !filepath.IsAbs(pattern) && !strings.HasPrefix(pattern, "~") {
+				pattern = filepath.Join(filepath.Dir(userConfig), pattern)
+			}
+			if strings.HasPrefix(pattern, "~/") {
+				userHome, err := os.UserHomeDir()
+				if err != nil {
+					return false, err
+				}
+				pattern = filepath.Join(userHome, pattern[2:])
+			}
+			if ok, _ := filepath.Match(pattern, file); ok {
+				return true, nil
+			}
+		}
+	}
+	return false, scanner.Err()
+}
+
+// withLock runs fn while holding a lock for file. The lock file and the
+// temporary files are hidden, so that they are not matched by an Include of
+// all files in the directory.
+func withLock(file string, fn func() error) error {
+	err := os.MkdirAll(filepath.Dir(file), 0o700)
+	if err != nil {
+		return err
+	}
+	return filelock.Run(hiddenFile(file, ".lock"), 0o600, fn)
+}
+
+// writeFile writes data to a temporary file and renames it to file.
+func writeFile(file string, data []byte) error {
+	tmpFile := hiddenFile(file, ".tmp")
+	err := os.WriteFile(tmpFile, data, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
+
+func hiddenFile(file, suffix string) string {
+	return filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+suffix)
+}
@@ -0,0 +1,79 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_Config_SaveLoad(t *testing.T) {
+	is := is.New(t)
+
+	file := filepath.Join(t.TempDir(), "config.d", "vu")
+	c := &Config{}
+	c.Set(Host{Name: "vm1", URI: "unix:/a", HostName: "192.168.122.10", User: "dvob"})
+	c.Set(Host{Name: "vm1", URI: "unix:/b", HostName: "192.168.122.11"})
+	c.Set(Host{Name: "vm1", URI: "unix:/a", HostName: "192.168.122.12", User: "dvob"})
+	is.NoErr(c.Save(file))
+
+	loaded, err := Load(file)
+	is.NoErr(err)
+	is.Equal(loaded.Hosts, c.Hosts)
+	is.Equal(loaded.Get("unix:/a", "vm1").HostName, "192.168.122.12") // entry replaced
+
+	loaded.Remove("unix:/a", "vm1")
+	is.Equal(len(loaded.Hosts), 1)
+	is.Equal(loaded.Get("unix:/a", "vm1"), nil)
+}
+
+func Test_Included(t *testing.T) {
+	is := is.New(t)
+
+	dir := t.TempDir()
+	userConfig := filepath.Join(dir, "config")
+	file := filepath.Join(dir, "config.d", "vu")
+
+	included, err := Included(userConfig, file)
+	is.NoErr(err)
+	is.True(!included) // missing config
+
+	is.NoErr(os.WriteFile(userConfig, []byte("Include config.d/*\n\nHost *\n  User test\n"), 0o600))
+	included, err = Included(userConfig, file)
+	is.NoErr(err)
+	is.True(included)
+}
+
+func Test_Config_Contexts(t *testing.T) {
+	is := is.New(t)
+
+	file := filepath.Join(t.TempDir(), "config.d", "vu")
+	err := Update(file, func(c *Config) error {
+		c.Set(Host{Name: "vm1", URI: "unix:/a", Context: "a", HostName: "192.168.122.10"})
+		c.Set(Host{Name: "vm1", URI: "unix:/b", Context: "b", HostName: "192.168.122.11"})
+		c.Set(Host{Name: "vm2", URI: "unix:/a", Context: "a", HostName: "192.168.122.12"})
+		return nil
+	})
+	is.NoErr(err)
+
+	data, err := os.ReadFile(file)
+	is.NoErr(err)
+	is.True(strings.Contains(string(data), "Host vm1.a\n"))     // name used in two contexts
+	is.True(strings.Contains(string(data), "Host vm1.b\n"))     // name used in two contexts
+	is.True(strings.Contains(string(data), "Host vm2.a vm2\n")) // unique name
+
+	loaded, err := Load(file)
+	is.NoErr(err)
+	is.Equal(loaded.Hosts, []Host{
+		{Name: "vm1", URI: "unix:/a", Context: "a", HostName: "192.168.122.10"},
+		{Name: "vm1", URI: "unix:/b", Context: "b", HostName: "192.168.122.11"},
+		{Name: "vm2", URI: "unix:/a", Context: "a", HostName: "192.168.122.12"},
+	})
+
+	// the context b refers to another host now
+	loaded.Set(Host{Name: "vm1", URI: "unix:/c", Context: "b"})
+	is.Equal(len(loaded.Hosts), 3)
+	is.Equal(loaded.Get("unix:/b", "vm1"), nil)
+}
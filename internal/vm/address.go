@@ -0,0 +1,122 @@
+package vm
+
+import (
+	"fmt"
+	"net"
+)
+
+// Sources of the IP addresses of a VM.
+const (
+	// AddressSourceAgent queries the QEMU guest agent in the VM.
+	AddressSourceAgent = "agent"
+	// AddressSourceLease uses the DHCP leases of the network.
+	AddressSourceLease = "lease"
+	// AddressSourceARP uses the ARP cache of the host.
+	AddressSourceARP = "arp"
+)
+
+// AddressOptions define how the IP address of a VM is determined. The
+// sources are queried in order until a source reports an address. If
+// multiple addresses are known, an address in Subnet or an address of
+// Interface (name of the interface in the guest or name of the network) is
+// preferred.
+type AddressOptions struct {
+	Sources   []string
+	Interface string
+	Subnet    string
+}
+
+// DefaultAddressOptions returns the default address options.
+func DefaultAddressOptions() AddressOptions {
+	return AddressOptions{
+		Sources: []string{AddressSourceAgent, AddressSourceLease, AddressSourceARP},
+	}
+}
+
+// Validate checks the sources and the subnet.
+func (o *AddressOptions) Validate() error {
+	for _, source := range o.Sources {
+		switch source {
+		case AddressSourceAgent, AddressSourceLease, AddressSourceARP:
+		default:
+			return fmt.Errorf("invalid address source '%s': use %s, %s or %s", source, AddressSourceAgent, AddressSourceLease, AddressSourceARP)
+		}
+	}
+	if o.Subnet != "" {
+		_, _, err := net.ParseCIDR(o.Subnet)
+		if err != nil {
+			return fmt.Errorf("invalid preferred subnet: %w", err)
+		}
+	}
+	return nil
+}
+
+// Select returns the preferred address of the interfaces. Without a matching
+// preferred subnet or interface, an address of the first interface which
+// is attached to a network is used. IPv4 addresses are preferred over IPv6
+// addresses. If no address is known, an empty string is returned.
+func (o *AddressOptions) Select(ifaces []Interface) string {
+	if o.Subnet != "" {
+		_, subnet, err := net.ParseCIDR(o.Subnet)
+		if err == nil {
+			for _, iface := range ifaces {
+				for _, address := range iface.Addresses {
+					ip, _, err := net.ParseCIDR(address)
+					if err == nil && subnet.Contains(ip) {
+						return ip.String()
+					}
+				}
+			}
+		}
+	}
+
+	if o.Interface != "" {
+		for _, iface := range ifaces {
+			if iface.Name == o.Interface || iface.Network == o.Interface {
+				if ip := selectIP(iface.Addresses); ip != "" {
+					return ip
+				}
+			}
+		}
+	}
+
+	for _, iface := range ifaces {
+		if iface.Network == "" {
+			continue
+		}
+		if ip := selectIP(iface.Addresses); ip != "" {
+			return ip
+		}
+	}
+	for _, iface := range ifaces {
+		if ip := selectIP(iface.Addresses); ip != "" {
+			return ip
+		}
+	}
+	return ""
+}
+
+// selectIP returns the first IPv4 address or the first IPv6 address if there
+// is no IPv4 address.
+func selectIP(addresses []string) string {
+	var first string
+	for _, address := range addresses {
+		ip, _, err := net.ParseCIDR(address)
+		if err != nil {
+			continue
+		}
+		if ip.To4() != nil {
+			return ip.String()
+		}
+		if first == "" {
+			first = ip.String()
+		}
+	}
+	return first
+}
+
+// UsableIP reports whether the address can be used to reach a VM. Loopback
+// and link-local addresses are not usable.
+func UsableIP(ip net.IP) bool {
+	return ip != nil && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsUnspecified()
+}
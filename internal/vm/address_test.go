@@ -0,0 +1,34 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_AddressOptions_Select(t *testing.T) {
+	is := is.New(t)
+
+	ifaces := []Interface{
+		{Name: "docker0", Addresses: []string{"172.17.0.1/16"}},
+		{Name: "enp1s0", Network: "default", MAC: "52:54:00:00:00:01", Addresses: []string{"fd00::10/64", "192.168.122.10/24"}},
+		{Name: "enp2s0", Network: "lab", MAC: "52:54:00:00:00:02", Addresses: []string{"10.10.0.5/24"}},
+	}
+
+	o := DefaultAddressOptions()
+	is.Equal(o.Select(ifaces), "192.168.122.10") // first network interface, IPv4 preferred
+
+	o.Interface = "lab"
+	is.Equal(o.Select(ifaces), "10.10.0.5") // preferred interface by network
+
+	o.Interface = "docker0"
+	is.Equal(o.Select(ifaces), "172.17.0.1") // preferred interface by guest name
+
+	o.Subnet = "fd00::/64"
+	is.Equal(o.Select(ifaces), "fd00::10") // preferred subnet
+
+	is.Equal(o.Select(nil), "")
+
+	o.Sources = []string{"agent", "dns"}
+	is.True(o.Validate() != nil) // invalid source
+}
@@ -0,0 +1,46 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned if a VM does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is returned if a VM with the same name exists
+	// already.
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrInUse is returned if a resource can not be changed since it is
+	// used.
+	ErrInUse = errors.New("is in use")
+	// ErrInvalidState is returned if an operation is not possible in the
+	// current state of the VM (e.g. starting a running VM).
+	ErrInvalidState = errors.New("is in an invalid state")
+)
+
+// Error is returned by the backends to describe a failed operation on a VM.
+// Kind is one of the sentinel errors of this package and Err the optional
+// underlying error of the backend.
+type Error struct {
+	Name string
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("vm '%s' %s", e.Name, e.Kind)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is reports whether target is the kind of the error.
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
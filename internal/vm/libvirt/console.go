@@ -0,0 +1,21 @@
+package libvirt
+
+import (
+	"io"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+// Console streams the output of the first console of the domain. go-libvirt
+// only supports streams in one direction, so the console is read-only.
+func (m *Manager) Console(name string, w io.Writer, force bool) error {
+	dom, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	var flags uint32
+	if force {
+		flags = uint32(libvirt.DomainConsoleForce)
+	}
+	return mapError(name, m.DomainOpenConsole(dom, nil, w, flags))
+}
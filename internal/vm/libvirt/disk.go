@@ -0,0 +1,294 @@
+package libvirt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/dvob/vu/internal/vm"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// detachTimeout is the time the guest has to release a disk which is
+// detached from a running domain.
+const detachTimeout = 10 * time.Second
+
+// diskPrefixes are the prefixes of the target device names per bus.
+var diskPrefixes = map[string]string{
+	vm.DiskBusVirtIO: "vd",
+	vm.DiskBusSCSI:   "sd",
+}
+
+// nextTarget returns the first device name on the bus which is not used yet.
+func nextTarget(bus string, used []string) (string, error) {
+	prefix, ok := diskPrefixes[bus]
+	if !ok {
+		return "", fmt.Errorf("unsupported disk bus '%s'", bus)
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		target := prefix + string(c)
+		if !containsString(used, target) {
+			return target, nil
+		}
+	}
+	return "", fmt.Errorf("no free device name on bus '%s'", bus)
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+// usedTargets returns the target device names of all disks (including
+// CDROMs) of the domain.
+func usedTargets(disks []libvirtxml.DomainDisk) []string {
+	targets := []string{}
+	for _, disk := range disks {
+		if disk.Target != nil {
+			targets = append(targets, disk.Target.Dev)
+		}
+	}
+	return targets
+}
+
+// dataDisk returns the domain disk for the disk. If the disk has no target
+// the next free device name on its bus is used.
+func (m *Manager) dataDisk(disk vm.Disk, used []string) (*libvirtxml.DomainDisk, error) {
+	if disk.Bus == "" {
+		disk.Bus = vm.DiskBusVirtIO
+	}
+	source, format, err := m.diskSource(disk.Image)
+	if err != nil {
+		return nil, err
+	}
+	target := disk.Target
+	if target == "" {
+		target, err = nextTarget(disk.Bus, used)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &libvirtxml.DomainDisk{
+		Device: "disk",
+		Driver: &libvirtxml.DomainDiskDriver{
+			Name: "qemu",
+			Type: format,
+		},
+		Target: &libvirtxml.DomainDiskTarget{
+			Dev: target,
+			Bus: disk.Bus,
+		},
+		Source: source,
+	}, nil
+}
+
+// scsiController returns the controller for disks on the SCSI bus. Without
+// an explicit model libvirt would choose an emulated controller.
+func scsiController() libvirtxml.DomainController {
+	return libvirtxml.DomainController{
+		Type:  "scsi",
+		Model: "virtio-scsi",
+	}
+}
+
+func hasSCSIController(vmDef *libvirtxml.Domain) bool {
+	if vmDef.Devices == nil {
+		return false
+	}
+	for _, controller := range vmDef.Devices.Controllers {
+		if controller.Type == "scsi" {
+			return true
+		}
+	}
+	return false
+}
+
+// getDisks returns the disks (without CDROMs) of the domain.
+func getDisks(vmDef *libvirtxml.Domain) []vm.Disk {
+	if vmDef.Devices == nil {
+		return nil
+	}
+	disks := []vm.Disk{}
+	for _, disk := range vmDef.Devices.Disks {
+		if disk.Device != "disk" || disk.Target == nil {
+			continue
+		}
+		disks = append(disks, toDisk(disk))
+	}
+	return disks
+}
+
+func toDisk(diskDef libvirtxml.DomainDisk) vm.Disk {
+	disk := vm.Disk{
+		Bus:    diskDef.Target.Bus,
+		Target: diskDef.Target.Dev,
+	}
+	if diskDef.Source != nil && diskDef.Source.File != nil {
+		disk.Image = diskDef.Source.File.File
+	}
+	if diskDef.Source != nil && diskDef.Source.Block != nil {
+		disk.Image = diskDef.Source.Block.Dev
+	}
+	return disk
+}
+
+func (m *Manager) domainDef(dom libvirt.Domain) (*libvirtxml.Domain, error) {
+	xml, err := m.DomainGetXMLDesc(dom, 0)
+	if err != nil {
+		return nil, err
+	}
+	vmDef := &libvirtxml.Domain{}
+	err = vmDef.Unmarshal(xml)
+	if err != nil {
+		return nil, err
+	}
+	return vmDef, nil
+}
+
+// modifyFlags returns the flags to change the persistent configuration of the
+// domain and the running domain if it is active.
+func (m *Manager) modifyFlags(dom libvirt.Domain) (uint32, error) {
+	flags := libvirt.DomainDeviceModifyConfig
+	active, err := m.DomainIsActive(dom)
+	if err != nil {
+		return 0, err
+	}
+	if active == 1 {
+		flags |= libvirt.DomainDeviceModifyLive
+	}
+	return uint32(flags), nil
+}
+
+func (m *Manager) AttachDisk(name string, disk vm.Disk) (*vm.Disk, error) {
+	dom, err := m.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	vmDef, err := m.domainDef(dom)
+	if err != nil {
+		return nil, err
+	}
+	flags, err := m.modifyFlags(dom)
+	if err != nil {
+		return nil, err
+	}
+
+	var disks []libvirtxml.DomainDisk
+	if vmDef.Devices != nil {
+		disks = vmDef.Devices.Disks
+	}
+	diskDef, err := m.dataDisk(disk, usedTargets(disks))
+	if err != nil {
+		return nil, err
+	}
+
+	if diskDef.Target.Bus == vm.DiskBusSCSI && !hasSCSIController(vmDef) {
+		controller := scsiController()
+		xml, err := controller.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		err = m.DomainAttachDeviceFlags(dom, xml, flags)
+		if err != nil {
+			return nil, fmt.Errorf("failed to attach SCSI controller: %w", mapError(name, err))
+		}
+	}
+
+	xml, err := diskDef.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	err = m.DomainAttachDeviceFlags(dom, xml, flags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach disk: %w", mapError(name, err))
+	}
+	return &vm.Disk{
+		Image:  disk.Image,
+		Bus:    diskDef.Target.Bus,
+		Target: diskDef.Target.Dev,
+	}, nil
+}
+
+func (m *Manager) DetachDisk(name, target string) (*vm.Disk, error) {
+	dom, err := m.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	vmDef, err := m.domainDef(dom)
+	if err != nil {
+		return nil, err
+	}
+	flags, err := m.modifyFlags(dom)
+	if err != nil {
+		return nil, err
+	}
+
+	var disks []libvirtxml.DomainDisk
+	if vmDef.Devices != nil {
+		disks = vmDef.Devices.Disks
+	}
+	for _, diskDef := range disks {
+		if diskDef.Device != "disk" || diskDef.Target == nil || diskDef.Target.Dev != target {
+			continue
+		}
+		xml, err := diskDef.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		err = m.DomainDetachDeviceFlags(dom, xml, flags)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detach disk: %w", mapError(name, err))
+		}
+		disk := toDisk(diskDef)
+		if flags&uint32(libvirt.DomainDeviceModifyLive) != 0 {
+			err = m.waitForDetach(dom, target)
+			if err != nil {
+				return &disk, err
+			}
+		}
+		return &disk, nil
+	}
+	return nil, fmt.Errorf("disk '%s' of vm '%s' %w", target, name, vm.ErrNotFound)
+}
+
+// waitForDetach waits until the disk with the target is removed from the
+// running domain. The removal from a running domain is asynchronous and
+// requires the cooperation of the guest.
+func (m *Manager) waitForDetach(dom libvirt.Domain, target string) error {
+	deadline := time.Now().Add(detachTimeout)
+	for {
+		vmDef, err := m.domainDef(dom)
+		if err != nil {
+			return err
+		}
+		attached := false
+		for _, disk := range getDisks(vmDef) {
+			if disk.Target == target {
+				attached = true
+			}
+		}
+		if !attached {
+			return nil
+		}
+		// the disk is removed if the domain stopped in the meantime
+		active, err := m.DomainIsActive(dom)
+		if err != nil {
+			return err
+		}
+		if active != 1 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return &vm.Error{
+				Name: dom.Name,
+				Kind: vm.ErrInUse,
+				Err:  fmt.Errorf("disk '%s' was not released by the guest within %s", target, detachTimeout),
+			}
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
@@ -0,0 +1,22 @@
+package libvirt
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_nextTarget(t *testing.T) {
+	is := is.New(t)
+
+	target, err := nextTarget("virtio", []string{"vda", "vdb"})
+	is.NoErr(err)
+	is.Equal(target, "vdc") // after image and ISO
+
+	target, err = nextTarget("scsi", []string{"vda", "vdb"})
+	is.NoErr(err)
+	is.Equal(target, "sda") // separate names per bus
+
+	_, err = nextTarget("ide", nil)
+	is.True(err != nil) // unsupported bus
+}
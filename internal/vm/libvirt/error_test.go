@@ -0,0 +1,28 @@
+package libvirt
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/dvob/vu/internal/vm"
+	"github.com/matryer/is"
+)
+
+func Test_mapError(t *testing.T) {
+	is := is.New(t)
+
+	err := mapError("web1", libvirt.Error{Code: uint32(libvirt.ErrNoDomain)})
+	is.True(errors.Is(err, vm.ErrNotFound))
+	is.Equal(err.Error(), "vm 'web1' not found")
+
+	err = mapError("web1", libvirt.Error{Code: uint32(libvirt.ErrDomExist)})
+	is.True(errors.Is(err, vm.ErrAlreadyExists))
+
+	// wrapped errors of the libvirt connection are mapped as well
+	err = mapError("web1", fmt.Errorf("failed: %w", libvirt.Error{Code: uint32(libvirt.ErrOperationInvalid)}))
+	is.True(errors.Is(err, vm.ErrInvalidState))
+
+	is.NoErr(mapError("web1", nil))
+}
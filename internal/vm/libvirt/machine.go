@@ -0,0 +1,237 @@
+package libvirt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/dvob/vu/internal/vm"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// defaultEmulatedCPU is the CPU model of emulated aarch64 VMs. Without a
+// model QEMU uses a 32-bit CPU for the virt machine, which can not boot
+// aarch64 images.
+const defaultEmulatedCPU = "cortex-a57"
+
+// domainCPU returns the CPU configuration for the mode or nil to use the
+// default of the hypervisor. Emulated aarch64 VMs (domain type qemu) use
+// defaultEmulatedCPU if no mode is set.
+func domainCPU(cfg *vm.Config, domainType string) *libvirtxml.DomainCPU {
+	if cfg.CPUMode == "" && domainType == "qemu" && cfg.Arch == vm.ArchAArch64 {
+		return &libvirtxml.DomainCPU{
+			Mode:  vm.CPUModeCustom,
+			Match: "exact",
+			Model: &libvirtxml.DomainCPUModel{
+				Value: defaultEmulatedCPU,
+			},
+		}
+	}
+	if cfg.CPUMode == "" {
+		return nil
+	}
+	cpu := &libvirtxml.DomainCPU{
+		Mode: cfg.CPUMode,
+	}
+	if cfg.CPUMode == vm.CPUModeCustom {
+		cpu.Match = "exact"
+		cpu.Model = &libvirtxml.DomainCPUModel{
+			Value: cfg.CPUModel,
+		}
+	}
+	return cpu
+}
+
+// setFirmware configures the firmware of the domain. For UEFI libvirt selects
+// the firmware (e.g. OVMF or AAVMF) and creates the NVRAM of the domain.
+// Secure boot requires SMM on x86_64. Other architectures than x86_64 always
+// use UEFI.
+func setFirmware(domain *libvirtxml.Domain, cfg *vm.Config) {
+	firmware := cfg.Firmware
+	if firmware == "" && !isX86(cfg.Arch) {
+		firmware = vm.FirmwareUEFI
+	}
+	if firmware == "" || firmware == vm.FirmwareBIOS {
+		return
+	}
+	secureBoot := "no"
+	if firmware == vm.FirmwareUEFISecure {
+		secureBoot = "yes"
+		if isX86(cfg.Arch) {
+			domain.Features.SMM = &libvirtxml.DomainFeatureSMM{
+				State: "on",
+			}
+		}
+	}
+	domain.OS.Firmware = "efi"
+	domain.OS.FirmwareInfo = &libvirtxml.DomainOSFirmwareInfo{
+		Features: []libvirtxml.DomainOSFirmwareFeature{
+			{
+				Name:    "secure-boot",
+				Enabled: secureBoot,
+			},
+			{
+				Name:    "enrolled-keys",
+				Enabled: secureBoot,
+			},
+		},
+	}
+}
+
+func isX86(arch string) bool {
+	return arch == vm.ArchX86_64 || arch == "i686"
+}
+
+// hostArch returns the architecture of the host, which is used for VMs
+// without an architecture.
+func (m *Manager) hostArch() (string, error) {
+	xml, err := m.ConnectGetCapabilities()
+	if err != nil {
+		return "", err
+	}
+	caps := &libvirtxml.Caps{}
+	err = caps.Unmarshal(xml)
+	if err != nil {
+		return "", err
+	}
+	if caps.Host.CPU == nil || caps.Host.CPU.Arch == "" {
+		return "", fmt.Errorf("failed to get host architecture")
+	}
+	return caps.Host.CPU.Arch, nil
+}
+
+// domainCaps returns the capabilities of the hypervisor for the
+// architecture and machine. They contain the domain type and the emulator.
+// libvirt uses KVM if it is available for the architecture and emulates the
+// VM with QEMU (TCG) otherwise.
+func (m *Manager) domainCaps(arch, machine string) (*libvirtxml.DomainCaps, error) {
+	optArch := libvirt.OptString{arch}
+	optMachine := libvirt.OptString{}
+	if machine != "" {
+		optMachine = libvirt.OptString{machine}
+	}
+	xml, err := m.ConnectGetDomainCapabilities(nil, optArch, optMachine, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("architecture '%s' is not supported by the hypervisor: %w", arch, err)
+	}
+	caps := &libvirtxml.DomainCaps{}
+	err = caps.Unmarshal(xml)
+	if err != nil {
+		return nil, err
+	}
+	return caps, nil
+}
+
+// checkFirmware returns an error if the domain uses UEFI but no UEFI firmware
+// for the architecture is installed. Older versions of libvirt do not report
+// the firmware, in which case the check is skipped.
+func checkFirmware(domain *libvirtxml.Domain, caps *libvirtxml.DomainCaps) error {
+	if domain.OS.Firmware != "efi" || caps.OS == nil {
+		return nil
+	}
+	for _, enum := range caps.OS.Enums {
+		if enum.Name != "firmware" {
+			continue
+		}
+		for _, value := range enum.Values {
+			if value == "efi" {
+				return nil
+			}
+		}
+		return fmt.Errorf("no UEFI firmware for %s installed on the host", domain.OS.Type.Arch)
+	}
+	return nil
+}
+
+// domainMachine returns the machine type. Secure boot on x86_64 requires q35
+// and all other architectures use the generic virt machine.
+func domainMachine(cfg *vm.Config) string {
+	switch {
+	case cfg.Machine != "":
+		return cfg.Machine
+	case !isX86(cfg.Arch):
+		return "virt"
+	case cfg.Firmware == vm.FirmwareUEFISecure:
+		return "q35"
+	default:
+		return ""
+	}
+}
+
+// domainFeatures returns the features for the architecture. APIC only exists
+// on x86.
+func domainFeatures(arch string) *libvirtxml.DomainFeatureList {
+	switch {
+	case isX86(arch):
+		return &libvirtxml.DomainFeatureList{
+			ACPI: &libvirtxml.DomainFeature{},
+			APIC: &libvirtxml.DomainFeatureAPIC{},
+		}
+	case arch == vm.ArchAArch64:
+		return &libvirtxml.DomainFeatureList{
+			ACPI: &libvirtxml.DomainFeature{},
+		}
+	default:
+		return &libvirtxml.DomainFeatureList{}
+	}
+}
+
+// domainVideos returns a VGA device on x86_64. The other architectures only
+// have the serial console.
+func domainVideos(arch string) []libvirtxml.DomainVideo {
+	if !isX86(arch) {
+		return nil
+	}
+	return []libvirtxml.DomainVideo{
+		{
+			Model: libvirtxml.DomainVideoModel{
+				Type: "vga",
+			},
+		},
+	}
+}
+
+// cdromTarget returns the target of the CDROM with the config ISO. The q35
+// machine has no IDE controller, so SATA is used instead. The virt machine
+// has neither, so SCSI is used.
+func cdromTarget(arch, machine string) *libvirtxml.DomainDiskTarget {
+	if !isX86(arch) {
+		return &libvirtxml.DomainDiskTarget{
+			Dev: "sda",
+			Bus: vm.DiskBusSCSI,
+		}
+	}
+	if strings.Contains(machine, "q35") {
+		return &libvirtxml.DomainDiskTarget{
+			Dev: "sda",
+			Bus: "sata",
+		}
+	}
+	return &libvirtxml.DomainDiskTarget{
+		Dev: "vdb",
+		Bus: "ide",
+	}
+}
+
+// domainTPMs returns an emulated TPM 2.0, which requires swtpm on the host.
+// The CRB interface only exists on x86, the virt machine of aarch64 uses the
+// TIS interface.
+func domainTPMs(tpm bool, arch string) []libvirtxml.DomainTPM {
+	if !tpm {
+		return nil
+	}
+	model := "tpm-crb"
+	if !isX86(arch) {
+		model = "tpm-tis-device"
+	}
+	return []libvirtxml.DomainTPM{
+		{
+			Model: model,
+			Backend: &libvirtxml.DomainTPMBackend{
+				Emulator: &libvirtxml.DomainTPMBackendEmulator{
+					Version: "2.0",
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,60 @@
+package libvirt
+
+import (
+	"testing"
+
+	"github.com/dvob/vu/internal/vm"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+	"github.com/matryer/is"
+)
+
+func Test_domainCPU(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(domainCPU(&vm.Config{Arch: vm.ArchX86_64}, "qemu"), nil)
+	is.Equal(domainCPU(&vm.Config{Arch: vm.ArchAArch64}, "kvm"), nil)
+
+	cpu := domainCPU(&vm.Config{Arch: vm.ArchAArch64}, "qemu")
+	is.True(cpu != nil) // the default CPU of the virt machine is 32-bit
+	is.Equal(cpu.Model.Value, defaultEmulatedCPU)
+
+	cpu = domainCPU(&vm.Config{Arch: vm.ArchAArch64, CPUMode: vm.CPUModeCustom, CPUModel: "max"}, "qemu")
+	is.Equal(cpu.Model.Value, "max")
+}
+
+func Test_archDefaults(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(domainMachine(&vm.Config{Arch: vm.ArchX86_64}), "")
+	is.Equal(domainMachine(&vm.Config{Arch: vm.ArchAArch64}), "virt")
+	is.Equal(domainFeatures(vm.ArchAArch64).APIC, nil)
+	is.Equal(cdromTarget(vm.ArchAArch64, "virt").Bus, vm.DiskBusSCSI)
+	is.Equal(domainTPMs(true, vm.ArchX86_64)[0].Model, "tpm-crb")
+	is.Equal(domainTPMs(true, vm.ArchAArch64)[0].Model, "tpm-tis-device") // no CRB on the virt machine
+}
+
+func Test_checkFirmware(t *testing.T) {
+	is := is.New(t)
+
+	domain := &libvirtxml.Domain{
+		OS: &libvirtxml.DomainOS{
+			Type: &libvirtxml.DomainOSType{Arch: vm.ArchRISCV64},
+		},
+	}
+	setFirmware(domain, &vm.Config{Arch: vm.ArchRISCV64})
+	is.Equal(domain.OS.Firmware, "efi")
+
+	caps := &libvirtxml.DomainCaps{
+		OS: &libvirtxml.DomainCapsOS{
+			Enums: []libvirtxml.DomainCapsEnum{
+				{Name: "firmware"},
+			},
+		},
+	}
+	is.True(checkFirmware(domain, caps) != nil) // no firmware installed
+
+	caps.OS.Enums[0].Values = []string{"efi"}
+	is.NoErr(checkFirmware(domain, caps))
+
+	is.NoErr(checkFirmware(domain, &libvirtxml.DomainCaps{})) // not reported
+}
@@ -0,0 +1,76 @@
+package libvirt
+
+import (
+	"github.com/dvob/vu/internal/vm"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// MountType returns virtiofs if the hypervisor supports it and 9p otherwise.
+func (m *Manager) MountType() (string, error) {
+	xml, err := m.ConnectGetDomainCapabilities(nil, nil, nil, nil, 0)
+	if err != nil {
+		return "", err
+	}
+	caps := &libvirtxml.DomainCaps{}
+	err = caps.Unmarshal(xml)
+	if err != nil {
+		return "", err
+	}
+	if caps.Devices == nil || caps.Devices.FileSystem == nil || caps.Devices.FileSystem.Supported != "yes" {
+		return vm.MountType9P, nil
+	}
+	for _, enum := range caps.Devices.FileSystem.Enums {
+		if enum.Name == "driverType" && containsString(enum.Values, "virtiofs") {
+			return vm.MountTypeVirtioFS, nil
+		}
+	}
+	return vm.MountType9P, nil
+}
+
+// domainFilesystems returns the filesystem devices for the mounts. For 9p the
+// mapped access mode is used since QEMU does not run as root.
+func domainFilesystems(mounts []vm.Mount, mountType string) []libvirtxml.DomainFilesystem {
+	filesystems := []libvirtxml.DomainFilesystem{}
+	for _, mount := range mounts {
+		fs := libvirtxml.DomainFilesystem{
+			AccessMode: "mapped",
+			Source: &libvirtxml.DomainFilesystemSource{
+				Mount: &libvirtxml.DomainFilesystemSourceMount{
+					Dir: mount.Source,
+				},
+			},
+			Target: &libvirtxml.DomainFilesystemTarget{
+				Dir: mount.Tag,
+			},
+		}
+		if mount.Type(mountType) == vm.MountTypeVirtioFS {
+			fs.AccessMode = "passthrough"
+			fs.Driver = &libvirtxml.DomainFilesystemDriver{
+				Type: "virtiofs",
+			}
+		} else if mount.ReadOnly {
+			fs.ReadOnly = &libvirtxml.DomainFilesystemReadOnly{}
+		}
+		filesystems = append(filesystems, fs)
+	}
+	return filesystems
+}
+
+// memoryBacking returns the shared memory which virtiofs requires.
+func memoryBacking(mounts []vm.Mount, mountType string) *libvirtxml.DomainMemoryBacking {
+	virtiofs := false
+	for _, mount := range mounts {
+		virtiofs = virtiofs || mount.Type(mountType) == vm.MountTypeVirtioFS
+	}
+	if !virtiofs {
+		return nil
+	}
+	return &libvirtxml.DomainMemoryBacking{
+		MemorySource: &libvirtxml.DomainMemorySource{
+			Type: "memfd",
+		},
+		MemoryAccess: &libvirtxml.DomainMemoryAccess{
+			Mode: "shared",
+		},
+	}
+}
@@ -0,0 +1,31 @@
+package libvirt
+
+import (
+	"testing"
+
+	"github.com/dvob/vu/internal/vm"
+	"github.com/matryer/is"
+)
+
+func Test_domainFilesystems(t *testing.T) {
+	is := is.New(t)
+
+	mounts := []vm.Mount{
+		{Source: "/src/code", Tag: "code"},
+		{Source: "/src/data", Tag: "data", ReadOnly: true},
+	}
+
+	filesystems := domainFilesystems(mounts, vm.MountTypeVirtioFS)
+	is.Equal(len(filesystems), 2)
+	is.Equal(filesystems[0].Driver.Type, "virtiofs")
+	is.Equal(filesystems[0].ReadOnly, nil)
+	is.Equal(filesystems[1].Driver, nil)          // read-only mounts use 9p
+	is.True(filesystems[1].ReadOnly != nil)       // read-only on the host side
+	is.Equal(filesystems[1].AccessMode, "mapped") // QEMU does not run as root
+	is.True(memoryBacking(mounts, vm.MountTypeVirtioFS) != nil)
+
+	filesystems = domainFilesystems(mounts, vm.MountType9P)
+	is.Equal(filesystems[0].Driver, nil)
+	is.Equal(filesystems[0].Target.Dir, "code")
+	is.Equal(memoryBacking(mounts, vm.MountType9P), nil) // only required for virtiofs
+}
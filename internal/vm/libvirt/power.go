@@ -0,0 +1,135 @@
+package libvirt
+
+import (
+	"errors"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/dvob/vu/internal/vm"
+)
+
+func (m *Manager) Reboot(name string, force bool) error {
+	dom, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	if force {
+		return mapError(name, m.DomainReset(dom, 0))
+	}
+	return mapError(name, m.DomainReboot(dom, libvirt.DomainRebootDefault))
+}
+
+func (m *Manager) Pause(name string) error {
+	dom, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	return mapError(name, m.DomainSuspend(dom))
+}
+
+// Suspend asks the guest agent to suspend the guest to RAM. The domain stays
+// active in the state pmsuspended.
+func (m *Manager) Suspend(name string) error {
+	dom, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	return mapError(name, m.DomainPmSuspendForDuration(dom, uint32(libvirt.NodeSuspendTargetMem), 0, 0))
+}
+
+// Resume resumes a paused domain or wakes up a suspended domain. The clock of
+// the guest does not advance while the domain is paused or suspended, so it
+// is synchronized with the host afterwards if the guest agent is available.
+func (m *Manager) Resume(name string) error {
+	dom, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	state, _, err := m.DomainGetState(dom, UnusedFlag)
+	if err != nil {
+		return err
+	}
+	switch libvirt.DomainState(state) {
+	case libvirt.DomainPaused:
+		err = m.DomainResume(dom)
+		if err != nil {
+			return mapError(name, err)
+		}
+		_ = m.syncTime(dom)
+		return nil
+	case libvirt.DomainPmsuspended:
+		err = m.DomainPmWakeup(dom, 0)
+		if err != nil {
+			return mapError(name, err)
+		}
+		m.syncTimeAfterWakeup(dom)
+		return nil
+	default:
+		return &vm.Error{Name: name, Kind: vm.ErrInvalidState, Err: errors.New("not paused or suspended")}
+	}
+}
+
+// Save saves the domain with a managed save image. libvirt restores the domain
+// from the image on the next start.
+func (m *Manager) Save(name string) error {
+	dom, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	return mapError(name, m.DomainManagedSave(dom, 0))
+}
+
+func (m *Manager) Restore(name string) error {
+	dom, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	saved, err := m.DomainHasManagedSaveImage(dom, 0)
+	if err != nil {
+		return mapError(name, err)
+	}
+	if saved != 1 {
+		return &vm.Error{Name: name, Kind: vm.ErrInvalidState, Err: errors.New("no saved state")}
+	}
+	err = m.DomainCreate(dom)
+	if err != nil {
+		return mapError(name, err)
+	}
+	// the clock continues at the time of the save
+	_ = m.syncTime(dom)
+	return nil
+}
+
+func (m *Manager) SyncTime(name string) error {
+	dom, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	state, _, err := m.DomainGetState(dom, UnusedFlag)
+	if err != nil {
+		return err
+	}
+	if libvirt.DomainState(state) != libvirt.DomainRunning {
+		return &vm.Error{Name: name, Kind: vm.ErrInvalidState, Err: errors.New("not running")}
+	}
+	return mapError(name, m.syncTime(dom))
+}
+
+// wakeupSyncTimeout is the time in which the clock is synchronized after a
+// wakeup. The guest agent only answers once the guest has resumed.
+const wakeupSyncTimeout = 10 * time.Second
+
+// syncTimeAfterWakeup tries to synchronize the clock until the guest agent
+// answers or wakeupSyncTimeout is reached.
+func (m *Manager) syncTimeAfterWakeup(dom libvirt.Domain) {
+	deadline := time.Now().Add(wakeupSyncTimeout)
+	for m.syncTime(dom) != nil && time.Now().Before(deadline) {
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// syncTime sets the clock of the guest to the time of the host with the
+// guest agent.
+func (m *Manager) syncTime(dom libvirt.Domain) error {
+	return m.DomainSetTime(dom, 0, 0, libvirt.DomainTimeSync)
+}
@@ -0,0 +1,153 @@
+package libvirt
+
+import (
+	"fmt"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/dvob/vu/internal/vm"
+)
+
+func (m *Manager) Resize(name string, size vm.Size) (bool, error) {
+	dom, err := m.lookup(name)
+	if err != nil {
+		return false, err
+	}
+	active, err := m.DomainIsActive(dom)
+	if err != nil {
+		return false, err
+	}
+
+	restart := false
+	if size.DiskSize != 0 {
+		err = m.resizeDisk(dom, active == 1, size.DiskSize)
+		if err != nil {
+			return false, err
+		}
+	}
+	if size.Memory != 0 {
+		applied, err := m.setMemory(dom, active == 1, size.Memory)
+		if err != nil {
+			return false, fmt.Errorf("failed to set memory: %w", mapError(name, err))
+		}
+		restart = restart || !applied
+	}
+	if size.CPUCount != 0 {
+		applied, err := m.setVCPUs(dom, active == 1, size.CPUCount)
+		if err != nil {
+			return false, fmt.Errorf("failed to set vCPUs: %w", mapError(name, err))
+		}
+		restart = restart || !applied
+	}
+	return restart, nil
+}
+
+// resizeDisk grows the first disk of the domain. The disk of a running domain
+// is resized by the hypervisor, otherwise the volume is resized directly.
+func (m *Manager) resizeDisk(dom libvirt.Domain, live bool, size uint64) error {
+	vmDef, err := m.domainDef(dom)
+	if err != nil {
+		return err
+	}
+	disks := getDisks(vmDef)
+	if len(disks) == 0 || disks[0].Image == "" {
+		return fmt.Errorf("vm '%s' has no disk to resize", dom.Name)
+	}
+	disk := disks[0]
+
+	vol, err := m.StorageVolLookupByPath(disk.Image)
+	if err != nil {
+		return fmt.Errorf("failed to get volume '%s': %w", disk.Image, err)
+	}
+	_, capacity, _, err := m.StorageVolGetInfo(vol)
+	if err != nil {
+		return err
+	}
+	if size < capacity {
+		return fmt.Errorf("disk of vm '%s' can not shrink from %d to %d bytes", dom.Name, capacity, size)
+	}
+	if size == capacity {
+		return nil
+	}
+
+	if live {
+		err = m.DomainBlockResize(dom, disk.Target, size, libvirt.DomainBlockResizeBytes)
+	} else {
+		err = m.StorageVolResize(vol, size, 0)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resize disk '%s': %w", disk.Target, mapError(dom.Name, err))
+	}
+	return nil
+}
+
+// setMemory sets the memory of the domain. The running domain can only use
+// up to the maximum memory it was started with. It returns false if the
+// memory is only set in the persistent configuration.
+func (m *Manager) setMemory(dom libvirt.Domain, live bool, memory uint64) (bool, error) {
+	kib := memory / 1024
+	// libvirt lowers the current memory if it exceeds the maximum
+	err := m.DomainSetMemoryFlags(dom, kib, uint32(libvirt.DomainMemConfig|libvirt.DomainMemMaximum))
+	if err != nil {
+		return false, err
+	}
+	err = m.DomainSetMemoryFlags(dom, kib, uint32(libvirt.DomainMemConfig))
+	if err != nil {
+		return false, err
+	}
+	if !live {
+		return true, nil
+	}
+
+	maxMemory, err := m.DomainGetMaxMemory(dom)
+	if err != nil {
+		return false, err
+	}
+	if kib > maxMemory {
+		return false, nil
+	}
+	// without a balloon driver in the guest the change has no effect
+	err = m.DomainSetMemoryFlags(dom, kib, uint32(libvirt.DomainMemLive))
+	return err == nil, nil
+}
+
+// setVCPUs sets the number of vCPUs of the domain. vCPUs can only be added to
+// the running domain up to the maximum it was started with. It returns false
+// if the number is only set in the persistent configuration.
+func (m *Manager) setVCPUs(dom libvirt.Domain, live bool, count uint) (bool, error) {
+	n := uint32(count)
+	current, err := m.DomainGetVcpusFlags(dom, uint32(libvirt.DomainVCPUConfig))
+	if err != nil {
+		return false, err
+	}
+	setMaximum := func() error {
+		return m.DomainSetVcpusFlags(dom, n, uint32(libvirt.DomainVCPUConfig|libvirt.DomainVCPUMaximum))
+	}
+	setCurrent := func() error {
+		return m.DomainSetVcpusFlags(dom, n, uint32(libvirt.DomainVCPUConfig))
+	}
+	// the current number can not exceed the maximum
+	steps := []func() error{setMaximum, setCurrent}
+	if n < uint32(current) {
+		steps = []func() error{setCurrent, setMaximum}
+	}
+	for _, step := range steps {
+		err = step()
+		if err != nil {
+			return false, err
+		}
+	}
+	if !live {
+		return true, nil
+	}
+
+	maxVCPUs, err := m.DomainGetVcpusFlags(dom, uint32(libvirt.DomainVCPULive|libvirt.DomainVCPUMaximum))
+	if err != nil {
+		return false, err
+	}
+	if n > uint32(maxVCPUs) {
+		return false, nil
+	}
+	// unplugging vCPUs fails if the guest does not release them
+	err = m.DomainSetVcpusFlags(dom, n, uint32(libvirt.DomainVCPULive))
+	return err == nil, nil
+}
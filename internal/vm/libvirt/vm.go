@@ -1,8 +1,11 @@
 package libvirt
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"strconv"
+	"strings"
 
 	"github.com/digitalocean/go-libvirt"
 	"github.com/dvob/vu/internal/vm"
@@ -15,35 +18,70 @@ const (
 
 var _ vm.Manager = &Manager{}
 
+// guestAgentChannel is the name of the channel of the QEMU guest agent.
+const guestAgentChannel = "org.qemu.guest_agent.0"
+
+// addressSources maps the address sources to the sources of libvirt.
+var addressSources = map[string]libvirt.DomainInterfaceAddressesSource{
+	vm.AddressSourceLease: libvirt.DomainInterfaceAddressesSrcLease,
+	vm.AddressSourceAgent: libvirt.DomainInterfaceAddressesSrcAgent,
+	vm.AddressSourceARP:   libvirt.DomainInterfaceAddressesSrcArp,
+}
+
 type Manager struct {
 	*libvirt.Libvirt
+	address vm.AddressOptions
 }
 
-func New(libvirt *libvirt.Libvirt) *Manager {
+func New(libvirt *libvirt.Libvirt, address vm.AddressOptions) *Manager {
 	return &Manager{
-		libvirt,
+		Libvirt: libvirt,
+		address: address,
 	}
 }
 
-func (m *Manager) Start(name string) error {
+// mapError maps libvirt errors to the errors of the vm package.
+func mapError(name string, err error) error {
+	var libvirtErr libvirt.Error
+	if !errors.As(err, &libvirtErr) {
+		return err
+	}
+	switch libvirt.ErrorNumber(libvirtErr.Code) {
+	case libvirt.ErrNoDomain:
+		return &vm.Error{Name: name, Kind: vm.ErrNotFound}
+	case libvirt.ErrDomExist:
+		return &vm.Error{Name: name, Kind: vm.ErrAlreadyExists}
+	case libvirt.ErrOperationInvalid:
+		return &vm.Error{Name: name, Kind: vm.ErrInvalidState, Err: err}
+	default:
+		return err
+	}
+}
+
+func (m *Manager) lookup(name string) (libvirt.Domain, error) {
 	dom, err := m.DomainLookupByName(name)
+	return dom, mapError(name, err)
+}
+
+func (m *Manager) Start(name string) error {
+	dom, err := m.lookup(name)
 	if err != nil {
 		return err
 	}
 
-	return m.DomainCreate(dom)
+	return mapError(name, m.DomainCreate(dom))
 }
 
 func (m *Manager) Shutdown(name string, force bool) error {
-	dom, err := m.DomainLookupByName(name)
+	dom, err := m.lookup(name)
 	if err != nil {
 		return err
 	}
 
 	if force {
-		return m.DomainDestroy(dom)
+		return mapError(name, m.DomainDestroy(dom))
 	}
-	return m.DomainShutdown(dom)
+	return mapError(name, m.DomainShutdown(dom))
 }
 
 func (m *Manager) ListDetail() error {
@@ -83,7 +121,7 @@ func (m *Manager) List() ([]vm.VM, error) {
 }
 
 func (m *Manager) Get(name string) (*vm.VM, error) {
-	dom, err := m.DomainLookupByName(name)
+	dom, err := m.lookup(name)
 	if err != nil {
 		return nil, err
 	}
@@ -106,9 +144,14 @@ func (m *Manager) get(dom libvirt.Domain) (*vm.VM, error) {
 		return nil, err
 	}
 	state.Images = getDisksFromDomain(vmDef)
+	state.Disks = getDisks(vmDef)
+	state.SerialLog = getSerialLog(vmDef)
+	state.Interfaces = m.getInterfaces(dom, vmDef)
 
-	// get IP
-	state.IPAddress = m.getIP(dom)
+	state.IPAddress = m.address.Select(state.Interfaces)
+	if state.IPAddress == "" {
+		state.IPAddress = "n/a"
+	}
 
 	// state
 	domState, _, err := m.DomainGetState(dom, UnusedFlag)
@@ -116,13 +159,22 @@ func (m *Manager) get(dom libvirt.Domain) (*vm.VM, error) {
 		return nil, err
 	}
 	state.State = stateToString(libvirt.DomainState(domState))
+	if libvirt.DomainState(domState) == libvirt.DomainShutoff {
+		saved, err := m.DomainHasManagedSaveImage(dom, 0)
+		if err != nil {
+			return nil, err
+		}
+		if saved == 1 {
+			state.State = vm.StateSaved
+		}
+	}
 	return state, nil
 }
 
 func stateToString(state libvirt.DomainState) string {
 	switch state {
 	case libvirt.DomainRunning:
-		return "running"
+		return vm.StateRunning
 	case libvirt.DomainBlocked:
 		return "blocked"
 	case libvirt.DomainPaused:
@@ -130,7 +182,7 @@ func stateToString(state libvirt.DomainState) string {
 	case libvirt.DomainShutdown:
 		return "shutdown"
 	case libvirt.DomainShutoff:
-		return "shutoff"
+		return vm.StateShutoff
 	case libvirt.DomainCrashed:
 		return "crashed"
 	case libvirt.DomainPmsuspended:
@@ -140,35 +192,96 @@ func stateToString(state libvirt.DomainState) string {
 	}
 }
 
-func (m *Manager) getIP(dom libvirt.Domain) string {
-	// dhcp leases
-	ifs, err := m.DomainInterfaceAddresses(dom, 0, UnusedFlag)
-	if err == nil && len(ifs) > 0 {
-		ip := getFirstIP(ifs)
-		if ip != "" {
-			return ip
+// getInterfaces returns the interfaces of the domain with the addresses of
+// the first address source which reports an address.
+func (m *Manager) getInterfaces(dom libvirt.Domain, vmDef *libvirtxml.Domain) []vm.Interface {
+	ifaces := getInterfacesFromDomain(vmDef)
+	for _, source := range m.address.Sources {
+		// without a connected agent the query fails anyway
+		if source == vm.AddressSourceAgent && !agentConnected(vmDef) {
+			continue
+		}
+		domIfaces, err := m.DomainInterfaceAddresses(dom, uint32(addressSources[source]), UnusedFlag)
+		if err != nil {
+			continue
+		}
+		result, found := mergeAddresses(ifaces, domIfaces, source == vm.AddressSourceAgent)
+		if found {
+			return result
 		}
 	}
+	return ifaces
+}
 
-	// arp cache
-	ifs, err = m.DomainInterfaceAddresses(dom, 2, UnusedFlag)
-	if err == nil && len(ifs) > 0 {
-		ip := getFirstIP(ifs)
-		if ip != "" {
-			return ip
+// mergeAddresses adds the usable addresses to the interfaces with the same
+// MAC address. Interfaces which are not part of the domain definition are
+// added. Only the agent reports the names of the interfaces in the guest.
+func mergeAddresses(ifaces []vm.Interface, domIfaces []libvirt.DomainInterface, guestNames bool) ([]vm.Interface, bool) {
+	result := append([]vm.Interface{}, ifaces...)
+	found := false
+	for _, domIface := range domIfaces {
+		addresses := []string{}
+		for _, addr := range domIface.Addrs {
+			if !vm.UsableIP(net.ParseIP(addr.Addr)) {
+				continue
+			}
+			addresses = append(addresses, fmt.Sprintf("%s/%d", addr.Addr, addr.Prefix))
 		}
+		if len(addresses) == 0 {
+			continue
+		}
+		found = true
+
+		mac := ""
+		if len(domIface.Hwaddr) > 0 {
+			mac = domIface.Hwaddr[0]
+		}
+		name := ""
+		if guestNames {
+			name = domIface.Name
+		}
+
+		i := indexByMAC(result, mac)
+		if i < 0 {
+			result = append(result, vm.Interface{
+				Name: name,
+				MAC:  mac,
+			})
+			i = len(result) - 1
+		}
+		result[i].Name = name
+		result[i].Addresses = append(result[i].Addresses, addresses...)
 	}
+	return result, found
+}
 
-	return "n/a"
+func indexByMAC(ifaces []vm.Interface, mac string) int {
+	if mac == "" {
+		return -1
+	}
+	for i, iface := range ifaces {
+		if strings.EqualFold(iface.MAC, mac) {
+			return i
+		}
+	}
+	return -1
 }
 
-func getFirstIP(ifaces []libvirt.DomainInterface) string {
-	for _, iface := range ifaces {
-		if len(iface.Addrs) > 0 {
-			return iface.Addrs[0].Addr
+// agentConnected reports whether the guest agent of a running domain is
+// connected.
+func agentConnected(vmDef *libvirtxml.Domain) bool {
+	if vmDef.Devices == nil {
+		return false
+	}
+	for _, channel := range vmDef.Devices.Channels {
+		if channel.Target == nil || channel.Target.VirtIO == nil {
+			continue
+		}
+		if channel.Target.VirtIO.Name == guestAgentChannel && channel.Target.VirtIO.State == "connected" {
+			return true
 		}
 	}
-	return ""
+	return false
 }
 
 func getDisksFromDomain(dom *libvirtxml.Domain) []string {
@@ -180,130 +293,309 @@ func getDisksFromDomain(dom *libvirtxml.Domain) []string {
 		if disk.Source == nil {
 			continue
 		}
-		disks = append(disks, disk.Source.File.File)
+		if disk.Source.File != nil {
+			disks = append(disks, disk.Source.File.File)
+		}
+		if disk.Source.Block != nil {
+			disks = append(disks, disk.Source.Block.Dev)
+		}
 	}
 	return disks
 }
 
+func getInterfacesFromDomain(dom *libvirtxml.Domain) []vm.Interface {
+	if dom.Devices == nil {
+		return nil
+	}
+	ifaces := []vm.Interface{}
+	for _, iface := range dom.Devices.Interfaces {
+		if iface.Source == nil || iface.Source.Network == nil {
+			continue
+		}
+		i := vm.Interface{
+			Network: iface.Source.Network.Network,
+		}
+		if iface.MAC != nil {
+			i.MAC = iface.MAC.Address
+		}
+		ifaces = append(ifaces, i)
+	}
+	return ifaces
+}
+
+// diskSource returns the disk source and the driver type for the volume with
+// the given path. Volumes which are block devices (e.g. logical volumes) are
+// attached as block devices, all others as files.
+func (m *Manager) diskSource(path string) (*libvirtxml.DomainDiskSource, string, error) {
+	vol, err := m.StorageVolLookupByPath(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get volume '%s': %w", path, err)
+	}
+	xml, err := m.StorageVolGetXMLDesc(vol, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	volDef := &libvirtxml.StorageVolume{}
+	err = volDef.Unmarshal(xml)
+	if err != nil {
+		return nil, "", err
+	}
+
+	format := "raw"
+	if volDef.Target != nil && volDef.Target.Format != nil {
+		switch volDef.Target.Format.Type {
+		case "", "none", "unknown":
+		default:
+			format = volDef.Target.Format.Type
+		}
+	}
+
+	if volDef.Type == "block" {
+		return &libvirtxml.DomainDiskSource{
+			Block: &libvirtxml.DomainDiskSourceBlock{
+				Dev: path,
+			},
+		}, format, nil
+	}
+	return &libvirtxml.DomainDiskSource{
+		File: &libvirtxml.DomainDiskSourceFile{
+			File: path,
+		},
+	}, format, nil
+}
+
 func (m *Manager) Create(name string, cfg *vm.Config) error {
+	// the defaults of the machine, devices and firmware depend on the
+	// architecture
+	if cfg.Arch == "" {
+		arch, err := m.hostArch()
+		if err != nil {
+			return err
+		}
+		c := *cfg
+		c.Arch = arch
+		cfg = &c
+	}
+	err := cfg.ValidateArch()
+	if err != nil {
+		return err
+	}
+
+	imageSource, imageFormat, err := m.diskSource(cfg.Image)
+	if err != nil {
+		return err
+	}
+
+	isoSource, isoFormat, err := m.diskSource(cfg.ISO)
+	if err != nil {
+		return err
+	}
+
+	machine := domainMachine(cfg)
+	disks := []libvirtxml.DomainDisk{
+		{
+			Device: "disk",
+			Driver: &libvirtxml.DomainDiskDriver{
+				Name: "qemu",
+				Type: imageFormat,
+			},
+			Target: &libvirtxml.DomainDiskTarget{
+				Dev: "vda",
+				Bus: "virtio",
+			},
+			Source: imageSource,
+		}, {
+			Device: "cdrom",
+			Driver: &libvirtxml.DomainDiskDriver{
+				Name: "qemu",
+				Type: isoFormat,
+			},
+			Target: cdromTarget(cfg.Arch, machine),
+			Source: isoSource,
+		},
+	}
+	for _, disk := range cfg.Disks {
+		diskDef, err := m.dataDisk(disk, usedTargets(disks))
+		if err != nil {
+			return err
+		}
+		disks = append(disks, *diskDef)
+	}
+	controllers := []libvirtxml.DomainController{}
+	for _, disk := range disks {
+		if disk.Target.Bus == vm.DiskBusSCSI {
+			controllers = append(controllers, scsiController())
+			break
+		}
+	}
+
+	caps, err := m.domainCaps(cfg.Arch, machine)
+	if err != nil {
+		return err
+	}
+
+	mountType := ""
+	if len(cfg.Mounts) > 0 {
+		mountType, err = m.MountType()
+		if err != nil {
+			return fmt.Errorf("failed to get mount type: %w", err)
+		}
+	}
+
 	domain := &libvirtxml.Domain{
 		Name:        name,
-		Type:        "kvm",
+		Type:        caps.Domain,
 		Description: "created by vu",
 		Memory: &libvirtxml.DomainMemory{
 			Value: uint(cfg.Memory),
 			Unit:  "b",
 		},
+		MemoryBacking: memoryBacking(cfg.Mounts, mountType),
 		VCPU: &libvirtxml.DomainVCPU{
 			Value: cfg.CPUCount,
 		},
+		CPU: domainCPU(cfg, caps.Domain),
 		OS: &libvirtxml.DomainOS{
 			Type: &libvirtxml.DomainOSType{
-				Type: "hvm",
+				Type:    "hvm",
+				Arch:    cfg.Arch,
+				Machine: machine,
 			},
 		},
-		Features: &libvirtxml.DomainFeatureList{
-			ACPI: &libvirtxml.DomainFeature{},
-			APIC: &libvirtxml.DomainFeatureAPIC{},
-		},
+		Features: domainFeatures(cfg.Arch),
 		Devices: &libvirtxml.DomainDeviceList{
-			Disks: []libvirtxml.DomainDisk{
-				{
-					Device: "disk",
-					Driver: &libvirtxml.DomainDiskDriver{
-						Name: "qemu",
-						Type: "qcow2",
-					},
-					Target: &libvirtxml.DomainDiskTarget{
-						Dev: "vda",
-						Bus: "virtio",
-					},
-					Source: &libvirtxml.DomainDiskSource{
-						File: &libvirtxml.DomainDiskSourceFile{
-							File: cfg.Image,
-						},
-					},
-				}, {
-					Device: "cdrom",
-					Driver: &libvirtxml.DomainDiskDriver{
-						Name: "qemu",
-						Type: "raw",
-					},
-					Target: &libvirtxml.DomainDiskTarget{
-						Dev: "vdb",
-						Bus: "ide",
-					},
-					Source: &libvirtxml.DomainDiskSource{
-						File: &libvirtxml.DomainDiskSourceFile{
-							File: cfg.ISO,
-						},
-					},
-				},
-			},
-			Interfaces: []libvirtxml.DomainInterface{
-				{
-					Source: &libvirtxml.DomainInterfaceSource{
-						Network: &libvirtxml.DomainInterfaceSourceNetwork{
-							Network: cfg.Network,
-						},
-					},
-					Model: &libvirtxml.DomainInterfaceModel{
-						Type: "virtio",
-					},
-				},
-			},
-			Serials: []libvirtxml.DomainSerial{
-				{},
-			},
-			Videos: []libvirtxml.DomainVideo{
-				{
-					Model: libvirtxml.DomainVideoModel{
-						Type: "vga",
-					},
-				},
-			},
+			Emulator:    caps.Path,
+			Disks:       disks,
+			Controllers: controllers,
+			Filesystems: domainFilesystems(cfg.Mounts, mountType),
+			Interfaces:  domainInterfaces(cfg.NICs),
+			Channels:    domainChannels(cfg.GuestAgent),
+			Serials:     domainSerials(cfg.SerialLog),
+			TPMs:        domainTPMs(cfg.TPM, cfg.Arch),
+			Videos:      domainVideos(cfg.Arch),
 		},
 	}
 
+	setFirmware(domain, cfg)
+	err = checkFirmware(domain, caps)
+	if err != nil {
+		return err
+	}
+
 	xml, err := domain.Marshal()
 	if err != nil {
-		return nil
+		return err
 	}
 
 	dom, err := m.DomainDefineXML(xml)
 	if err != nil {
-		return fmt.Errorf("failed to define domain: %w", err)
+		return fmt.Errorf("failed to define domain: %w", mapError(name, err))
 	}
 
 	err = m.DomainCreate(dom)
 	if err != nil {
+		// do not leave a domain behind which refers to the images
+		_ = m.DomainUndefineFlags(dom, libvirt.DomainUndefineNvram)
 		return fmt.Errorf("failed to create domain: %w", err)
 	}
 	return err
 }
 
+// domainSerials returns the serial console. If log is set, the output of the
+// console is appended to the file.
+func domainSerials(log string) []libvirtxml.DomainSerial {
+	serial := libvirtxml.DomainSerial{
+		Source: &libvirtxml.DomainChardevSource{
+			Pty: &libvirtxml.DomainChardevSourcePty{},
+		},
+	}
+	if log != "" {
+		serial.Log = &libvirtxml.DomainChardevLog{
+			File:   log,
+			Append: "on",
+		}
+	}
+	return []libvirtxml.DomainSerial{serial}
+}
+
+func getSerialLog(vmDef *libvirtxml.Domain) string {
+	if vmDef.Devices == nil {
+		return ""
+	}
+	for _, serial := range vmDef.Devices.Serials {
+		if serial.Log != nil {
+			return serial.Log.File
+		}
+	}
+	return ""
+}
+
+func domainChannels(guestAgent bool) []libvirtxml.DomainChannel {
+	if !guestAgent {
+		return nil
+	}
+	return []libvirtxml.DomainChannel{
+		{
+			Source: &libvirtxml.DomainChardevSource{
+				UNIX: &libvirtxml.DomainChardevSourceUNIX{
+					Mode: "bind",
+				},
+			},
+			Target: &libvirtxml.DomainChannelTarget{
+				VirtIO: &libvirtxml.DomainChannelTargetVirtIO{
+					Name: guestAgentChannel,
+				},
+			},
+		},
+	}
+}
+
+func domainInterfaces(nics []vm.NIC) []libvirtxml.DomainInterface {
+	ifaces := []libvirtxml.DomainInterface{}
+	for _, nic := range nics {
+		iface := libvirtxml.DomainInterface{
+			Source: &libvirtxml.DomainInterfaceSource{
+				Network: &libvirtxml.DomainInterfaceSourceNetwork{
+					Network: nic.Network,
+				},
+			},
+			Model: &libvirtxml.DomainInterfaceModel{
+				Type: "virtio",
+			},
+		}
+		if nic.MAC != "" {
+			iface.MAC = &libvirtxml.DomainInterfaceMAC{
+				Address: nic.MAC,
+			}
+		}
+		ifaces = append(ifaces, iface)
+	}
+	return ifaces
+}
+
 // Remove removes the domain and its volumes
 func (m *Manager) Remove(name string) error {
-	dom, err := m.DomainLookupByName(name)
+	dom, err := m.lookup(name)
 	if err != nil {
 		return err
 	}
 
-	stateInt, _, err := m.DomainGetState(dom, UnusedFlag)
-	state := libvirt.DomainState(stateInt)
+	// paused and suspended domains are active as well
+	active, err := m.DomainIsActive(dom)
 	if err != nil {
 		return err
 	}
-	if state == libvirt.DomainRunning || state == libvirt.DomainPaused {
+	if active == 1 {
 		err = m.DomainDestroy(dom)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = m.DomainUndefine(dom)
+	// removes the saved state and the NVRAM of UEFI domains
+	err = m.DomainUndefineFlags(dom, libvirt.DomainUndefineManagedSave|libvirt.DomainUndefineNvram)
 	if err != nil {
-		return err
+		return mapError(name, err)
 	}
 
 	return nil
@@ -0,0 +1,21 @@
+package vm
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// bootMarker matches the first message of the Linux kernel on each boot.
+var bootMarker = regexp.MustCompile(`\[\s*0\.000000\] Linux version`)
+
+// SinceBoot returns the part of a serial console log since the last boot. A
+// boot is recognized by the first message of the Linux kernel. If no boot is
+// found the whole log is returned.
+func SinceBoot(log []byte) []byte {
+	locs := bootMarker.FindAllIndex(log, -1)
+	if len(locs) == 0 {
+		return log
+	}
+	start := bytes.LastIndexByte(log[:locs[len(locs)-1][0]], '\n') + 1
+	return log[start:]
+}
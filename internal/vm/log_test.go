@@ -0,0 +1,17 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_SinceBoot(t *testing.T) {
+	is := is.New(t)
+
+	log := "[    0.000000] Linux version 5.15.0\r\nfirst boot\r\n" +
+		"[    0.000000] Linux version 5.15.0\r\nsecond boot\r\n"
+	is.Equal(string(SinceBoot([]byte(log))), "[    0.000000] Linux version 5.15.0\r\nsecond boot\r\n") // last boot only
+
+	is.Equal(string(SinceBoot([]byte("no kernel\n"))), "no kernel\n") // whole log without boot
+}
@@ -0,0 +1,29 @@
+package vm
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+)
+
+// RandomMAC returns a random MAC address within the OUI of QEMU (52:54:00).
+func RandomMAC() (string, error) {
+	buf := make([]byte, 3)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return formatMAC(buf), nil
+}
+
+// NameMAC returns a MAC address within the OUI of QEMU (52:54:00) which is
+// derived from the name of the VM and the index of the interface. A VM which
+// is recreated with the same name gets the same MAC addresses again.
+func NameMAC(name string, index int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%d", name, index)))
+	return formatMAC(sum[:3])
+}
+
+func formatMAC(buf []byte) string {
+	return fmt.Sprintf("52:54:00:%02x:%02x:%02x", buf[0], buf[1], buf[2])
+}
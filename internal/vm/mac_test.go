@@ -0,0 +1,17 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_NameMAC(t *testing.T) {
+	is := is.New(t)
+
+	mac := NameMAC("mytest1", 0)
+	is.Equal(mac[:9], "52:54:00:")        // QEMU OUI
+	is.Equal(mac, NameMAC("mytest1", 0))  // deterministic
+	is.True(mac != NameMAC("mytest1", 1)) // differs per interface
+	is.True(mac != NameMAC("mytest2", 0)) // differs per VM
+}
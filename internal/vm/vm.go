@@ -1,12 +1,79 @@
 package vm
 
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
 type Manager interface {
 	Create(name string, config *Config) error
 	Start(name string) error
 	Shutdown(name string, force bool) error
+	// Reboot reboots a running VM. If force is set the VM is reset
+	// instead of asking the guest to reboot.
+	Reboot(name string, force bool) error
+	// Pause stops the vCPUs of a running VM until it is resumed.
+	Pause(name string) error
+	// Suspend suspends a running VM to RAM from within the guest, which
+	// requires the guest agent.
+	Suspend(name string) error
+	// Resume resumes a paused or suspended VM.
+	Resume(name string) error
+	// Save saves the memory of a running VM to disk and stops it. The VM
+	// is restored from the saved state on its next start.
+	Save(name string) error
+	// Restore starts a saved VM from its saved state.
+	Restore(name string) error
+	// SyncTime sets the clock of a running VM to the time of the host,
+	// which requires the guest agent. The clock of a VM falls behind if
+	// the VM or the host was paused or suspended.
+	SyncTime(name string) error
 	Remove(name string) error
 	List() ([]VM, error)
 	Get(name string) (*VM, error)
+	// AttachDisk attaches a disk to a VM. If the VM is running the disk is
+	// also attached to the running VM. It returns the disk with the
+	// target device.
+	AttachDisk(name string, disk Disk) (*Disk, error)
+	// DetachDisk detaches the disk with the target device from a VM and
+	// returns it. If a running VM does not release the disk, the disk is
+	// returned together with an error of the kind ErrInUse.
+	DetachDisk(name, target string) (*Disk, error)
+	// Resize changes the size of a VM. Changes which are not possible on
+	// the running VM are applied on its next start, in which case it
+	// returns true.
+	Resize(name string, size Size) (bool, error)
+	// MountType returns the type of the shared directories which are
+	// supported by the hypervisor (MountTypeVirtioFS or MountType9P).
+	MountType() (string, error)
+	// Console writes the output of the serial console of a running VM to
+	// w until the console is closed (e.g. when the VM stops). If force is
+	// set other console sessions are disconnected.
+	Console(name string, w io.Writer, force bool) error
+}
+
+// validName matches host names, since the name of a VM is its host name.
+// Other characters (e.g. _) can be used to separate the name of the VM from
+// a suffix in the names of its images.
+var validName = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?$`)
+
+// ValidateName returns an error if name is not a valid name of a VM.
+func ValidateName(name string) error {
+	if len(name) > 253 || !validName.MatchString(name) {
+		return fmt.Errorf("invalid vm name '%s': use letters, digits, '-' and '.'", name)
+	}
+	return nil
+}
+
+// Size describes the resources of a VM which can be changed after its
+// creation. Values which are zero are not changed. DiskSize is the size of
+// the first disk, which can only grow.
+type Size struct {
+	DiskSize uint64
+	Memory   uint64
+	CPUCount uint
 }
 
 type Config struct {
@@ -14,13 +81,172 @@ type Config struct {
 	ISO      string
 	Memory   uint64
 	CPUCount uint
-	Network  string
+	NICs     []NIC
 	DiskSize uint64
+	// Disks are additional disks which are attached after the image and
+	// the ISO.
+	Disks []Disk
+	// Mounts are directories of the host which are shared with the VM.
+	Mounts []Mount
+	// SerialLog is the path of a file to which the output of the serial
+	// console is appended. If it is empty the output is not logged.
+	SerialLog string
+	// GuestAgent adds a channel for the QEMU guest agent.
+	GuestAgent bool
+	// CPUMode is one of the CPUMode constants. If it is empty the default
+	// of the hypervisor is used. CPUModel is the model for CPUModeCustom.
+	CPUMode  string
+	CPUModel string
+	// Firmware is one of the Firmware constants. Defaults to FirmwareBIOS
+	// on x86_64 and to FirmwareUEFI on all other architectures.
+	Firmware string
+	// Machine is the machine type (e.g. q35). If it is empty the default
+	// of the hypervisor is used.
+	Machine string
+	// TPM adds an emulated TPM 2.0.
+	TPM bool
+	// Arch is the architecture of the VM. If it is empty the architecture
+	// of the host is used. Architectures which the host CPU does not
+	// support are emulated.
+	Arch string
+}
+
+const (
+	ArchX86_64  = "x86_64"
+	ArchAArch64 = "aarch64"
+	ArchRISCV64 = "riscv64"
+)
+
+const (
+	CPUModeHostPassthrough = "host-passthrough"
+	CPUModeHostModel       = "host-model"
+	CPUModeCustom          = "custom"
+)
+
+const (
+	FirmwareBIOS       = "bios"
+	FirmwareUEFI       = "uefi"
+	FirmwareUEFISecure = "uefi-secure"
+)
+
+// Validate checks the CPU mode and the firmware.
+func (c *Config) Validate() error {
+	switch c.CPUMode {
+	case "", CPUModeHostPassthrough, CPUModeHostModel:
+		if c.CPUModel != "" {
+			return fmt.Errorf("a CPU model can only be set with CPU mode %s", CPUModeCustom)
+		}
+	case CPUModeCustom:
+		if c.CPUModel == "" {
+			return fmt.Errorf("CPU mode %s requires a CPU model", CPUModeCustom)
+		}
+	default:
+		return fmt.Errorf("invalid CPU mode '%s': use %s, %s or %s", c.CPUMode, CPUModeHostPassthrough, CPUModeHostModel, CPUModeCustom)
+	}
+	switch c.Firmware {
+	case "", FirmwareBIOS, FirmwareUEFI, FirmwareUEFISecure:
+	default:
+		return fmt.Errorf("invalid firmware '%s': use %s, %s or %s", c.Firmware, FirmwareBIOS, FirmwareUEFI, FirmwareUEFISecure)
+	}
+	switch c.Arch {
+	case "":
+		// checked by the backend with the architecture of the host
+		return nil
+	case ArchX86_64, ArchAArch64, ArchRISCV64:
+		return c.ValidateArch()
+	default:
+		return fmt.Errorf("invalid architecture '%s': use %s, %s or %s", c.Arch, ArchX86_64, ArchAArch64, ArchRISCV64)
+	}
+}
+
+// ValidateArch checks the options which depend on the architecture. BIOS is
+// only available on x86 and the TPM only on x86 and aarch64. Secure boot on
+// x86 requires SMM, which only the q35 machine supports.
+func (c *Config) ValidateArch() error {
+	x86 := c.Arch == ArchX86_64 || c.Arch == "i686"
+	if x86 && c.Firmware == FirmwareUEFISecure && c.Machine != "" && !strings.Contains(c.Machine, "q35") {
+		return fmt.Errorf("firmware %s (--firmware) requires the machine q35: use --machine q35 or omit --machine", FirmwareUEFISecure)
+	}
+	if !x86 && c.Firmware == FirmwareBIOS {
+		return fmt.Errorf("firmware %s is not supported on %s", FirmwareBIOS, c.Arch)
+	}
+	if !x86 && c.Arch != ArchAArch64 && c.TPM {
+		return fmt.Errorf("a TPM (--tpm) is not supported on %s", c.Arch)
+	}
+	return nil
+}
+
+// NIC is a network interface of a VM. If MAC is empty the backend chooses a
+// MAC address.
+type NIC struct {
+	Network string
+	MAC     string
 }
 
 type VM struct {
+	Name       string
+	State      string
+	IPAddress  string
+	Images     []string
+	Disks      []Disk
+	Interfaces []Interface
+	SerialLog  string
+}
+
+// States of a VM which the callers of a Manager have to know. The backends
+// may report other states as well.
+const (
+	StateRunning = "running"
+	StateShutoff = "shutoff"
+	// StateSaved is the state of a VM which is stopped and restored from
+	// its saved state on the next start.
+	StateSaved = "saved"
+)
+
+const (
+	MountTypeVirtioFS = "virtiofs"
+	MountType9P       = "9p"
+)
+
+// Mount is a directory of the host which is shared with a VM. Tag identifies
+// the directory in the VM.
+type Mount struct {
+	Source   string
+	Tag      string
+	ReadOnly bool
+}
+
+// Type returns the type of the mount if the hypervisor supports mountType
+// (see Manager.MountType). virtiofs can not share a directory read-only, so
+// read-only mounts always use 9p.
+func (m *Mount) Type(mountType string) string {
+	if m.ReadOnly {
+		return MountType9P
+	}
+	return mountType
+}
+
+const (
+	DiskBusVirtIO = "virtio"
+	DiskBusSCSI   = "scsi"
+)
+
+// Disk is a disk of a VM. Image is the ID of the image. Bus is either virtio
+// or scsi. Target is the device name of the disk (e.g. vdc or sda). If it is
+// empty the backend chooses the next free device name on the bus.
+type Disk struct {
+	Image  string
+	Bus    string
+	Target string
+}
+
+// Interface is a network interface of an existing VM. Name is the name of
+// the interface in the guest which is only known if the guest agent reports
+// the addresses. Interfaces which are only known to the guest (e.g. bridges)
+// have no network. Addresses are in CIDR notation.
+type Interface struct {
 	Name      string
-	State     string
-	IPAddress string
-	Images    []string
+	Network   string
+	MAC       string
+	Addresses []string
 }
@@ -0,0 +1,33 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_Config_Validate(t *testing.T) {
+	is := is.New(t)
+
+	is.NoErr((&Config{}).Validate()) // defaults of the hypervisor
+	is.NoErr((&Config{CPUMode: CPUModeCustom, CPUModel: "Skylake-Client", Firmware: FirmwareUEFISecure}).Validate())
+
+	is.True((&Config{CPUMode: CPUModeCustom}).Validate() != nil)                                // custom requires a model
+	is.True((&Config{CPUMode: CPUModeHostModel, CPUModel: "Skylake-Client"}).Validate() != nil) // model only with custom
+	is.True((&Config{Firmware: "coreboot"}).Validate() != nil)                                  // invalid firmware
+	is.True((&Config{Arch: ArchAArch64, Firmware: FirmwareBIOS}).Validate() != nil)             // no BIOS on aarch64
+	is.NoErr((&Config{Arch: ArchAArch64, TPM: true}).Validate())
+	is.True((&Config{Arch: ArchRISCV64, TPM: true}).Validate() != nil)                                  // no TPM on riscv64
+	is.True((&Config{Arch: ArchX86_64, Firmware: FirmwareUEFISecure, Machine: "pc"}).Validate() != nil) // no SMM on i440fx
+	is.NoErr((&Config{Arch: ArchX86_64, Firmware: FirmwareUEFISecure, Machine: "pc-q35-7.2"}).Validate())
+}
+
+func Test_ValidateName(t *testing.T) {
+	is := is.New(t)
+
+	is.NoErr(ValidateName("web1"))
+	is.NoErr(ValidateName("web-1.lab"))
+	is.True(ValidateName("web_data1") != nil) // separator of the data disks
+	is.True(ValidateName("-web") != nil)
+	is.True(ValidateName("") != nil)
+}
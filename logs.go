@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+
+	vu "github.com/dvob/vu/internal"
+	"github.com/spf13/cobra"
+)
+
+func newLogsCmd(mgr *vu.Manager) *cobra.Command {
+	opts := vu.LogOptions{}
+	cmd := &cobra.Command{
+		Use:   "logs NAME",
+		Short: "show the serial log of a VM",
+		Long: `Shows the output of the serial console of a VM since its creation, which
+contains the boot messages and the output of cloud-init.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return mgr.Logs(args[0], os.Stdout, opts)
+		},
+		ValidArgsFunction: completeVMFunc(mgr),
+	}
+	cmd.Flags().BoolVarP(&opts.Follow, "follow", "f", false, "keep showing new output")
+	cmd.Flags().BoolVar(&opts.SinceBoot, "since-boot", false, "only show the output since the last boot")
+	return cmd
+}
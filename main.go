@@ -1,17 +1,33 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 
 	vu "github.com/dvob/vu/internal"
+	"github.com/dvob/vu/internal/image"
+	"github.com/dvob/vu/internal/network"
+	"github.com/dvob/vu/internal/vm"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
 
 const (
 	envVarPrefix = "VU_"
+
+	// noConnectAnnotation marks commands which do not require a connection
+	// to libvirtd or which connect on their own.
+	noConnectAnnotation = "vu/no-connect"
+
+	// noContextAnnotation marks commands which do not depend on a valid
+	// context (e.g. context management).
+	noContextAnnotation = "vu/no-context"
+
+	// noEnvAnnotation marks flags which can not be set with environment
+	// variables (e.g. flags which are only used internally).
+	noEnvAnnotation = "vu/no-env"
 )
 
 var (
@@ -19,24 +35,65 @@ var (
 	commit  = "n/a"
 )
 
+// exit codes which allow scripts to distinguish between errors
+const (
+	exitError         = 1
+	exitNotFound      = 3
+	exitAlreadyExists = 4
+	exitInUse         = 5
+	exitInvalidState  = 6
+)
+
 func main() {
 	err := newRootCmd().Execute()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
+	}
+}
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, vm.ErrNotFound), errors.Is(err, image.ErrNotFound), errors.Is(err, network.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, vm.ErrAlreadyExists), errors.Is(err, image.ErrAlreadyExists), errors.Is(err, network.ErrAlreadyExists):
+		return exitAlreadyExists
+	case errors.Is(err, vm.ErrInUse), errors.Is(err, image.ErrInUse), errors.Is(err, network.ErrInUse):
+		return exitInUse
+	case errors.Is(err, vm.ErrInvalidState), errors.Is(err, image.ErrInvalidState):
+		return exitInvalidState
+	default:
+		return exitError
 	}
 }
 
 func newRootCmd() *cobra.Command {
-	mgr := &vu.Manager{}
-	opts := vu.NewLibvirtDefaultOptions()
+	var (
+		mgr         = &vu.Manager{}
+		opts        = vu.NewLibvirtDefaultOptions()
+		contextName string
+	)
 	cmd := &cobra.Command{
 		Use:              "vu",
 		Short:            "vu spins up virtual machines using cloud-init images",
 		TraverseChildren: true,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+
+			if _, noContext := cmd.Annotations[noContextAnnotation]; !noContext {
+				err := applyContext(cmd, contextName, opts)
+				if err != nil {
+					return err
+				}
+			}
+
 			var err error
+
 			cmd.Flags().VisitAll(func(f *pflag.Flag) {
+				if _, noEnv := f.Annotations[noEnvAnnotation]; noEnv {
+					return
+				}
 				optName := strings.ToUpper(f.Name)
 				optName = strings.ReplaceAll(optName, "-", "_")
 				varName := envVarPrefix + optName
@@ -51,28 +108,47 @@ func newRootCmd() *cobra.Command {
 				return err
 			}
 
+			if _, noConnect := cmd.Annotations[noConnectAnnotation]; noConnect {
+				return nil
+			}
+
 			m, err := vu.NewLibvirtManager(opts)
 			if err != nil {
 				return err
 			}
 			*mgr = *m
 
-			cmd.SilenceUsage = true
-			cmd.SilenceErrors = true
-
 			return err
 		},
 	}
 	opts.BindFlags(cmd, "")
+	cmd.Flags().StringVar(&contextName, "context", "", "name of the context to use instead of the current context")
 	cmd.AddCommand(
 		newImageCmd(mgr),
 		newCreateCmd(mgr),
 		newStartCmd(mgr),
 		newShutdownCmd(mgr),
+		newRebootCmd(mgr),
+		newPauseCmd(mgr),
+		newResumeCmd(mgr),
+		newSuspendCmd(mgr),
+		newSaveCmd(mgr),
+		newRestoreCmd(mgr),
+		newSyncTimeCmd(mgr),
 		newRemoveCmd(mgr),
 		newListCmd(mgr),
 		newShowCmd(mgr),
+		newResizeCmd(mgr),
+		newDiskCmd(mgr),
+		newConsoleCmd(mgr),
+		newLogsCmd(mgr),
+		newNetworkCmd(mgr),
+		newSSHConfigCmd(mgr),
+		newForwardCmd(mgr),
 		newConfigCmd(),
+		newContextCmd(),
+		newTemplateCmd(),
+		newDoctorCmd(opts),
 		newCompletionCmd(),
 		newVersionCmd(),
 	)
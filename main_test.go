@@ -0,0 +1,24 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dvob/vu/internal/image"
+	"github.com/dvob/vu/internal/network"
+	"github.com/dvob/vu/internal/vm"
+	"github.com/matryer/is"
+)
+
+func Test_exitCode(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(exitCode(errors.New("failed")), exitError)
+	is.Equal(exitCode(&vm.Error{Name: "web1", Kind: vm.ErrNotFound}), exitNotFound)
+	is.Equal(exitCode(&image.Error{Name: "foo.img", Kind: image.ErrAlreadyExists}), exitAlreadyExists)
+	is.Equal(exitCode(&network.Error{Name: "default", Kind: network.ErrInUse}), exitInUse)
+	is.Equal(exitCode(&vm.Error{Name: "web1", Kind: vm.ErrInvalidState}), exitInvalidState)
+	// errors wrapped by the commands keep their exit code
+	is.Equal(exitCode(fmt.Errorf("failed to get base image: %w", &image.Error{Kind: image.ErrNotFound})), exitNotFound)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/dvob/vu/internal/vm"
+)
+
+// parseMount parses the value of the --mount flag (e.g. /src/code:code:ro).
+// Relative paths are relative to the current directory.
+func parseMount(value string) (*vm.Mount, error) {
+	fields := strings.Split(value, ":")
+	if len(fields) < 2 || len(fields) > 3 || fields[0] == "" || fields[1] == "" {
+		return nil, fmt.Errorf("invalid mount '%s': expected HOST_PATH:TAG[:ro]", value)
+	}
+	source, err := filepath.Abs(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	mount := &vm.Mount{
+		Source: source,
+		Tag:    fields[1],
+	}
+	if len(fields) == 3 {
+		if fields[2] != "ro" {
+			return nil, fmt.Errorf("invalid mount option '%s' in '%s': only ro is supported", fields[2], value)
+		}
+		mount.ReadOnly = true
+	}
+	return mount, nil
+}
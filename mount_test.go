@@ -0,0 +1,30 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_parseMount(t *testing.T) {
+	is := is.New(t)
+
+	mount, err := parseMount("/src/code:code:ro")
+	is.NoErr(err)
+	source, _ := filepath.Abs("/src/code")
+	is.Equal(mount.Source, source)
+	is.Equal(mount.Tag, "code")
+	is.True(mount.ReadOnly)
+
+	mount, err = parseMount("code:code")
+	is.NoErr(err)
+	is.True(filepath.IsAbs(mount.Source)) // relative to the current directory
+	is.True(!mount.ReadOnly)
+
+	_, err = parseMount("/src/code")
+	is.True(err != nil) // tag missing
+
+	_, err = parseMount("/src/code:code:rw")
+	is.True(err != nil) // unknown option
+}
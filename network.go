@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	vu "github.com/dvob/vu/internal"
+	"github.com/dvob/vu/internal/network"
+	"github.com/spf13/cobra"
+)
+
+func newNetworkCmd(mgr *vu.Manager) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "network",
+		Short: "manage networks",
+	}
+	cmd.AddCommand(
+		newNetworkCreateCmd(mgr),
+		newNetworkListCmd(mgr),
+		newNetworkRemoveCmd(mgr),
+	)
+	return cmd
+}
+
+func newNetworkCreateCmd(mgr *vu.Manager) *cobra.Command {
+	var (
+		n         = &network.Network{}
+		dhcpRange string
+		noDHCP    bool
+	)
+	cmd := &cobra.Command{
+		Use:   "create NAME",
+		Short: "create a new network",
+		Long: `Creates a new network which is started automatically. In the modes nat and
+route the VMs can reach the outside. Networks in the mode isolated are only
+reachable from the host and the VMs in the network. Without --dhcp-range the
+upper half of the subnet is used for DHCP and the lower half remains for
+static addresses.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n.Name = args[0]
+
+			subnet, err := network.ParseSubnet(n.Subnet)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case noDHCP && dhcpRange != "":
+				return fmt.Errorf("--dhcp-range and --no-dhcp can not be used together")
+			case noDHCP:
+			case dhcpRange != "":
+				start, end, ok := strings.Cut(dhcpRange, "-")
+				if !ok {
+					return fmt.Errorf("invalid DHCP range '%s': use the format START-END", dhcpRange)
+				}
+				n.DHCPStart, n.DHCPEnd = start, end
+			default:
+				start, end := network.DefaultDHCPRange(subnet)
+				n.DHCPStart, n.DHCPEnd = start.String(), end.String()
+			}
+
+			err = n.Complete()
+			if err != nil {
+				return err
+			}
+			return mgr.Network.Create(n)
+		},
+	}
+	cmd.Flags().StringVar(&n.Mode, "mode", network.ModeNAT, "mode of the network: nat, isolated or route")
+	cmd.Flags().StringVar(&n.Subnet, "subnet", "", "IPv4 subnet of the network in CIDR notation (e.g. 10.10.0.0/24)")
+	cmd.Flags().StringVar(&n.Gateway, "gateway", "", "address of the host in the network (default first address of the subnet)")
+	cmd.Flags().StringVar(&dhcpRange, "dhcp-range", "", "DHCP range in the format START-END (e.g. 10.10.0.100-10.10.0.200)")
+	cmd.Flags().BoolVar(&noDHCP, "no-dhcp", false, "disable DHCP")
+	cmd.Flags().StringVar(&n.Domain, "domain", "", "DNS domain of the network")
+	_ = cmd.MarkFlagRequired("subnet")
+	return cmd
+}
+
+func newNetworkListCmd(mgr *vu.Manager) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "list networks and the VMs attached to them",
+		Aliases: []string{"ls"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			networks, err := mgr.Network.List()
+			if err != nil {
+				return err
+			}
+			attached, err := mgr.NetworkVMs()
+			if err != nil {
+				return err
+			}
+
+			w := &tabwriter.Writer{}
+			w.Init(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintf(w, "NAME\tMODE\tSUBNET\tDHCP\tDOMAIN\tACTIVE\tVMS\n")
+			for _, n := range networks {
+				dhcp := ""
+				if n.DHCPStart != "" {
+					dhcp = n.DHCPStart + "-" + n.DHCPEnd
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\t%s\n", n.Name, n.Mode, n.Subnet, dhcp, n.Domain, n.Active, strings.Join(attached[n.Name], ","))
+			}
+			w.Flush()
+			return nil
+		},
+	}
+	return cmd
+}
+
+func newNetworkRemoveCmd(mgr *vu.Manager) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "remove NAME...",
+		Short:   "remove networks which are not in use",
+		Aliases: []string{"rm"},
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, name := range args {
+				err := mgr.RemoveNetwork(name)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		ValidArgsFunction: completeNetworkFunc(mgr),
+	}
+	return cmd
+}
+
+func completeNetworkFunc(mgr *vu.Manager) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		networks, err := mgr.Network.List()
+		if err != nil {
+			cobra.CompErrorln(err.Error())
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		names := []string{}
+		for _, n := range networks {
+			if contains(n.Name, args) {
+				continue
+			}
+			names = append(names, n.Name)
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dvob/vu/internal/cloudinit"
+	"github.com/dvob/vu/internal/vm"
+)
+
+// nicOptions describes a network interface of a VM. If reservation is set,
+// the IPv4 address is assigned with a DHCP reservation in the network instead
+// of a static configuration in the guest.
+type nicOptions struct {
+	network     string
+	reservation bool
+	cloudinit.NetworkConfigOptions
+}
+
+// parseNIC parses the value of the --nic flag. The value is a comma separated
+// list of key=value pairs (e.g. network=lab,ip=10.0.0.5/24,mac=52:54:00:00:00:01).
+// The keys ip, gateway and dns can be used multiple times.
+func parseNIC(value string) (*nicOptions, error) {
+	var (
+		nic = &nicOptions{}
+		err error
+	)
+	for _, field := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid nic option '%s': expected key=value", field)
+		}
+		switch key {
+		case "network":
+			nic.network = val
+		case "ip":
+			nic.Addresses = append(nic.Addresses, val)
+		case "gateway":
+			nic.Gateways = append(nic.Gateways, val)
+		case "dns":
+			nic.Nameserver = append(nic.Nameserver, val)
+		case "dhcp6":
+			nic.DHCP6, err = strconv.ParseBool(val)
+		case "slaac":
+			nic.SLAAC, err = strconv.ParseBool(val)
+		case "reservation":
+			nic.reservation, err = strconv.ParseBool(val)
+		case "mac":
+			nic.MAC = val
+		default:
+			return nil, fmt.Errorf("unknown nic option '%s'", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for nic option '%s': %w", key, err)
+		}
+	}
+	return nic, nil
+}
+
+// vmNICs returns the network interfaces for the VM configuration. Interfaces
+// without a network are connected to the default network.
+func vmNICs(nics []nicOptions, defaultNetwork string) []vm.NIC {
+	vmNICs := []vm.NIC{}
+	for _, nic := range nics {
+		network := nic.network
+		if network == "" {
+			network = defaultNetwork
+		}
+		vmNICs = append(vmNICs, vm.NIC{
+			Network: network,
+			MAC:     nic.MAC,
+		})
+	}
+	return vmNICs
+}
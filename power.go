@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	vu "github.com/dvob/vu/internal"
+	"github.com/dvob/vu/internal/vm"
+	"github.com/spf13/cobra"
+)
+
+// newVMActionCmd returns a command which runs action on each VM passed as
+// argument. The action has to access mgr.VM on each call, since the manager
+// is connected after the commands are created.
+func newVMActionCmd(mgr *vu.Manager, use, short string, action func(name string) error) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, name := range args {
+				err := action(name)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		ValidArgsFunction: completeVMFunc(mgr),
+	}
+}
+
+func newRebootCmd(mgr *vu.Manager) *cobra.Command {
+	var force bool
+	cmd := newVMActionCmd(mgr, "reboot NAME...", "reboot VMs", func(name string) error {
+		return mgr.VM.Reboot(name, force)
+	})
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "reset the VMs instead of rebooting them gracefully")
+	return cmd
+}
+
+func newPauseCmd(mgr *vu.Manager) *cobra.Command {
+	return newVMActionCmd(mgr, "pause NAME...", "pause VMs", func(name string) error {
+		return mgr.VM.Pause(name)
+	})
+}
+
+func newSuspendCmd(mgr *vu.Manager) *cobra.Command {
+	cmd := newVMActionCmd(mgr, "suspend NAME...", "suspend VMs to RAM", func(name string) error {
+		return mgr.VM.Suspend(name)
+	})
+	cmd.Long = `Suspends VMs to RAM from within the guest like a suspend of a laptop. This
+requires the QEMU guest agent in the VM. Use resume to wake the VMs up.`
+	return cmd
+}
+
+func newResumeCmd(mgr *vu.Manager) *cobra.Command {
+	return newVMActionCmd(mgr, "resume NAME...", "resume paused or suspended VMs", func(name string) error {
+		return mgr.VM.Resume(name)
+	})
+}
+
+func newSaveCmd(mgr *vu.Manager) *cobra.Command {
+	cmd := newVMActionCmd(mgr, "save NAME...", "save the state of VMs to disk and stop them", func(name string) error {
+		return mgr.VM.Save(name)
+	})
+	cmd.Long = `Saves the memory of running VMs to disk and stops them. The VMs continue
+where they left off when they are restored or started again.`
+	return cmd
+}
+
+func newRestoreCmd(mgr *vu.Manager) *cobra.Command {
+	return newVMActionCmd(mgr, "restore NAME...", "start saved VMs from their saved state", func(name string) error {
+		return mgr.VM.Restore(name)
+	})
+}
+
+func newSyncTimeCmd(mgr *vu.Manager) *cobra.Command {
+	var all bool
+	cmd := &cobra.Command{
+		Use:   "sync-time [NAME...]",
+		Short: "set the clock of VMs to the time of the host",
+		Long: `Sets the clock of running VMs to the time of the host, which requires the
+QEMU guest agent in the VMs. The clock of the VMs falls behind while the host
+is suspended. Run sync-time --all after the host resumed (e.g. in a
+systemd-sleep hook) to synchronize all running VMs.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all && len(args) > 0 {
+				return fmt.Errorf("names are not allowed with --all")
+			}
+			if !all && len(args) == 0 {
+				return fmt.Errorf("at least one name or --all required")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !all {
+				for _, name := range args {
+					err := mgr.VM.SyncTime(name)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			vms, err := mgr.VM.List()
+			if err != nil {
+				return err
+			}
+			// continue with the other VMs if a VM has no guest agent
+			failed := 0
+			for _, v := range vms {
+				if v.State != vm.StateRunning {
+					continue
+				}
+				err := mgr.VM.SyncTime(v.Name)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to sync time of vm '%s': %s\n", v.Name, err)
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("failed to sync time of %d vms", failed)
+			}
+			return nil
+		},
+		ValidArgsFunction: completeVMFunc(mgr),
+	}
+	cmd.Flags().BoolVar(&all, "all", false, "sync the time of all running VMs")
+	return cmd
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	vu "github.com/dvob/vu/internal"
+	"github.com/dvob/vu/internal/sshconfig"
+	"github.com/spf13/cobra"
+)
+
+func newSSHConfigCmd(mgr *vu.Manager) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ssh-config",
+		Short: "regenerate the SSH config entries of the VMs",
+		Long: `Regenerates the SSH config entries of all VMs in ~/.ssh/config.d/vu. The
+file has to be included at the top of ~/.ssh/config:
+
+  Include config.d/vu
+
+Then you can connect to a VM with ssh NAME. The entries are also updated on
+create, start and remove.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defaults, err := defaultSSHHost()
+			if err != nil {
+				return err
+			}
+			err = mgr.RefreshSSHConfig(defaults)
+			if err != nil {
+				return err
+			}
+			return checkSSHConfigIncluded(mgr.SSHConfigFile)
+		},
+	}
+	return cmd
+}
+
+// defaultSSHHost returns the user and the identity file which are used by
+// default on create.
+func defaultSSHHost() (vu.SSHHost, error) {
+	localUser, err := user.Current()
+	if err != nil {
+		return vu.SSHHost{}, err
+	}
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		return vu.SSHHost{}, err
+	}
+	return vu.SSHHost{
+		User:         localUser.Username,
+		IdentityFile: filepath.Join(userHome, ".ssh", "id_rsa"),
+	}, nil
+}
+
+// identityFile returns the private key of a public key file. If the private
+// key is unknown an empty string is returned.
+func identityFile(pubKeyFile string) string {
+	if !strings.HasSuffix(pubKeyFile, ".pub") {
+		return ""
+	}
+	return strings.TrimSuffix(pubKeyFile, ".pub")
+}
+
+// checkSSHConfigIncluded prints a hint if the SSH config file of vu is not
+// included in ~/.ssh/config.
+func checkSSHConfigIncluded(file string) error {
+	userConfig, err := userSSHConfig()
+	if err != nil {
+		return err
+	}
+	included, err := sshconfig.Included(userConfig, file)
+	if err != nil {
+		return err
+	}
+	if !included {
+		fmt.Fprintf(os.Stderr, "%s is not included in %s. add the following line at the top of %s:\n  Include %s\n", file, userConfig, userConfig, file)
+	}
+	return nil
+}
+
+func userSSHConfig() (string, error) {
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userHome, ".ssh", "config"), nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// applyTemplate uses the values of the template as defaults for all flags
+// which were not set explicitly on the command line.
+func applyTemplate(flags *pflag.FlagSet, name string) error {
+	_, cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	tmpl, err := cfg.Template(name)
+	if err != nil {
+		return err
+	}
+	for flagName, values := range tmpl.Flags() {
+		f := flags.Lookup(flagName)
+		if f == nil || f.Changed {
+			continue
+		}
+		// replace values of repeatable flags instead of appending them
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			err = slice.Replace(values)
+		} else {
+			err = f.Value.Set(values[0])
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value for %s in template '%s': %w", flagName, tmpl.Name, err)
+		}
+	}
+	return nil
+}
+
+func newTemplateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "template",
+		Short: "show templates for new VMs",
+		Long: `Templates are configured in ~/.config/vu/config.yaml. Each template
+bundles the base image, the profiles, the size and the network options of new
+VMs. Use them with 'vu create --template NAME'.`,
+	}
+	cmd.AddCommand(
+		newTemplateListCmd(),
+		newTemplateShowCmd(),
+	)
+	return cmd
+}
+
+func newTemplateListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "list",
+		Short:       "list templates",
+		Aliases:     []string{"ls"},
+		Annotations: map[string]string{noConnectAnnotation: "", noContextAnnotation: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			w := &tabwriter.Writer{}
+			w.Init(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintf(w, "NAME\tIMAGE\tCPU\tMEMORY\tDISK\tNETWORK\tPROFILES\n")
+			for _, tmpl := range cfg.Templates {
+				cpu := ""
+				if tmpl.CPU != 0 {
+					cpu = fmt.Sprint(tmpl.CPU)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", tmpl.Name, tmpl.Image, cpu, tmpl.Memory, tmpl.DiskSize, tmpl.Network, strings.Join(tmpl.Profiles, ","))
+			}
+			w.Flush()
+			return nil
+		},
+	}
+	return cmd
+}
+
+func newTemplateShowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "show NAME",
+		Short:       "show a template",
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{noConnectAnnotation: "", noContextAnnotation: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			tmpl, err := cfg.Template(args[0])
+			if err != nil {
+				return err
+			}
+			data, err := yaml.Marshal(tmpl)
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(data)
+			return err
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return completeTemplateFunc(cmd, args, toComplete)
+		},
+	}
+	return cmd
+}
+
+func completeTemplateFunc(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	_, cfg, err := loadConfig()
+	if err != nil {
+		cobra.CompErrorln(err.Error())
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	names := []string{}
+	for _, tmpl := range cfg.Templates {
+		names = append(names, tmpl.Name)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
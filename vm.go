@@ -2,19 +2,29 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"text/tabwriter"
+	"time"
 
 	vu "github.com/dvob/vu/internal"
 	"github.com/dvob/vu/internal/cloudinit"
+	"github.com/dvob/vu/internal/sshconfig"
 	"github.com/dvob/vu/internal/vm"
 	"github.com/spf13/cobra"
 )
 
 type vmOptions struct {
-	vm vm.Config
-	ci cloudInitOptions
+	vm            vm.Config
+	ci            cloudInitOptions
+	network       string
+	dataDiskFlags []string
+	dataDisks     []vu.DiskOptions
+	mountFlags    []string
+	image         string
+	template      string
 }
 
 func (o *vmOptions) complete() error {
@@ -23,6 +33,28 @@ func (o *vmOptions) complete() error {
 		return err
 	}
 
+	err = o.vm.Validate()
+	if err != nil {
+		return err
+	}
+
+	o.dataDisks = []vu.DiskOptions{}
+	for _, dataDiskFlag := range o.dataDiskFlags {
+		disk, err := parseDataDisk(dataDiskFlag)
+		if err != nil {
+			return err
+		}
+		o.dataDisks = append(o.dataDisks, *disk)
+	}
+
+	o.vm.Mounts = []vm.Mount{}
+	for _, mountFlag := range o.mountFlags {
+		mount, err := parseMount(mountFlag)
+		if err != nil {
+			return err
+		}
+		o.vm.Mounts = append(o.vm.Mounts, *mount)
+	}
 	return nil
 }
 
@@ -31,9 +63,102 @@ func (o *vmOptions) bindFlags(cmd *cobra.Command) {
 
 	cmd.Flags().Var(NewByteSize(&o.vm.Memory), "memory", "amount of memory")
 	cmd.Flags().Var(NewByteSize(&o.vm.DiskSize), "disk-size", "size of the cloned image")
+	cmd.Flags().StringArrayVar(&o.dataDiskFlags, "data-disk", []string{}, "add an empty data disk with the given size (e.g. 20G,pool=data,bus=scsi). the disk is created in the VM image pool if no pool is set. the bus is virtio (default) or scsi. can be repeated.")
 
+	cmd.Flags().StringArrayVar(&o.mountFlags, "mount", []string{}, "share a directory of the host with the VM (e.g. /home/me/code:code:ro). it is mounted at /mnt/TAG in the VM. can be repeated.")
 	cmd.Flags().UintVar(&o.vm.CPUCount, "cpu", 1, "number of vCPUs")
-	cmd.Flags().StringVar(&o.vm.Network, "network", "default", "name of the network to connect to")
+	cmd.Flags().StringVar(&o.vm.CPUMode, "cpu-mode", "", "CPU mode (host-passthrough, host-model or custom). host-passthrough allows nested virtualization.")
+	cmd.Flags().StringVar(&o.vm.CPUModel, "cpu-model", "", "CPU model for the CPU mode custom (e.g. Skylake-Client)")
+	cmd.Flags().StringVar(&o.vm.Firmware, "firmware", "", "firmware (bios, uefi or uefi-secure). uefi-secure enables secure boot. (default bios on x86_64 and uefi on other architectures)")
+	cmd.Flags().StringVar(&o.vm.Arch, "arch", "", "architecture of the VM (x86_64, aarch64 or riscv64). architectures which the host does not support are emulated. (default architecture of the host)")
+	cmd.Flags().StringVar(&o.vm.Machine, "machine", "", "machine type (e.g. q35). the default of the hypervisor is used if not set, except for uefi-secure which requires q35.")
+	cmd.Flags().BoolVar(&o.vm.TPM, "tpm", false, "add an emulated TPM 2.0 (requires swtpm)")
+	cmd.Flags().BoolVar(&o.vm.GuestAgent, "guest-agent", true, "install the QEMU guest agent which reports the IP addresses of the VM")
+	cmd.Flags().StringVar(&o.network, "network", "default", "name of the network to connect to. used for all interfaces without a network.")
+}
+
+// addressFunc returns a function which allocates the addresses set to auto
+// and reserves the static IPv4 addresses of the VM. If no gateway is set, the
+// first interface with an allocated address uses the gateway of the network.
+// For interfaces with a DHCP reservation the IPv4 address is removed from the
+// static configuration and added as DHCP host to the network instead. The
+// changes are recorded in r.
+func (o *vmOptions) addressFunc(mgr *vu.Manager, name string, r *vu.Reservations) addressFunc {
+	return func(index int, nic *nicOptions) error {
+		network := nic.network
+		if network == "" {
+			network = o.network
+		}
+		// the addresses are shared with the options of the other VMs
+		addresses := append([]string{}, nic.Addresses...)
+		if nic.reservation && !hasIPv4(addresses) && !contains(autoAddress, addresses) {
+			addresses = append(addresses, autoAddress)
+		}
+		for i, address := range addresses {
+			if address != autoAddress {
+				err := mgr.ReserveAddress(network, name, address, r)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			address, gateway, err := mgr.AllocateAddress(network, name, r)
+			if err != nil {
+				return err
+			}
+			addresses[i] = address
+			if index == 0 && len(nic.Gateways) == 0 && !nic.reservation {
+				nic.Gateways = []string{gateway}
+			}
+		}
+		nic.Addresses = addresses
+		if !nic.reservation {
+			return nil
+		}
+
+		nic.Addresses = []string{}
+		reserved := ""
+		for _, address := range addresses {
+			ip, _, err := net.ParseCIDR(address)
+			if err != nil {
+				return err
+			}
+			if ip.To4() == nil {
+				nic.Addresses = append(nic.Addresses, address)
+				continue
+			}
+			if reserved != "" {
+				return fmt.Errorf("only one IPv4 address per interface can be assigned with a DHCP reservation")
+			}
+			reserved = ip.String()
+		}
+		return mgr.AddDHCPHost(network, name, nic.MAC, reserved, r)
+	}
+}
+
+// hasIPv4 returns true if one of the addresses is an IPv4 address.
+func hasIPv4(addresses []string) bool {
+	for _, address := range addresses {
+		ip, _, err := net.ParseCIDR(address)
+		if err == nil && ip.To4() != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// createArgs returns the base image and the names of the new VMs. If the
+// image is set with --image or a template, all arguments are names. Otherwise
+// the first argument is the base image.
+func createArgs(image string, args []string) (string, []string, error) {
+	if image != "" {
+		return image, args, nil
+	}
+	if len(args) < 2 {
+		return "", nil, fmt.Errorf("base image and at least one name required")
+	}
+	return args[0], args[1:], nil
 }
 
 func newCreateCmd(mgr *vu.Manager) *cobra.Command {
@@ -44,27 +169,103 @@ func newCreateCmd(mgr *vu.Manager) *cobra.Command {
 		},
 	}
 	cmd := &cobra.Command{
-		Use:   "create BASE_IMAGE NAME...",
+		Use:   "create [BASE_IMAGE] NAME...",
 		Short: "create new VMs from a base image",
-		Args:  cobra.MinimumNArgs(2),
+		Long: `Creates new VMs from a base image. The base image is either the first
+argument or set with --image or a template. With --image or a template which
+sets the base image, all arguments are names. With --template the values of a
+template are used for all flags which are not set on the command line, so
+--image overrides the base image of the template.`,
+		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if options.template != "" {
+				err := applyTemplate(cmd.Flags(), options.template)
+				if err != nil {
+					return err
+				}
+			}
 			err := options.complete()
 			if err != nil {
 				return err
 			}
-			baseImage := args[0]
-			names := args[1:]
+			baseImage, names, err := createArgs(options.image, args)
+			if err != nil {
+				return err
+			}
+			// a base image as first argument was probably meant to
+			// override the image of the template
+			if options.template != "" && !cmd.Flags().Changed("image") {
+				_, err = mgr.Image.Get(mgr.BaseImagePool, names[0])
+				if err == nil {
+					return fmt.Errorf("'%s' is a base image and not a name: use --image to override the image of template '%s'", names[0], options.template)
+				}
+			}
+			err = options.ci.checkCount(len(names))
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				err = vm.ValidateName(name)
+				if err != nil {
+					return err
+				}
+			}
 
 			for _, name := range names {
 				nameConfig := cloudinit.NewDefaultConfig(name, options.ci.user, options.ci.sshPubKey)
 
+				// the host key is known in advance so that the host key
+				// can be verified on the first connection
+				hostKey, err := sshconfig.GenerateHostKey(name)
+				if err != nil {
+					return err
+				}
+				nameConfig.UserData.SSHKeys = map[string]string{
+					"ed25519_private": hostKey.Private,
+					"ed25519_public":  hostKey.Public,
+				}
+
 				// TODO: copy?
-				err := options.ci.config.Merge(nameConfig)
+				err = options.ci.config.Merge(nameConfig)
+				if err != nil {
+					return err
+				}
+
+				options.ci.name = name
+				if options.vm.GuestAgent {
+					options.ci.config.UserData.EnableGuestAgent()
+				}
+				// allows to grow the disk with vu resize
+				options.ci.config.UserData.EnableResize()
+
+				// fail before addresses are allocated for an existing VM
+				_, err = mgr.VM.Get(name)
+				if err == nil {
+					return &vm.Error{Name: name, Kind: vm.ErrAlreadyExists}
+				}
+				if !errors.Is(err, vm.ErrNotFound) {
+					return err
+				}
+
+				reservations := &vu.Reservations{}
+				err = options.ci.completeNetwork(options.addressFunc(mgr, name, reservations))
+				if err == nil {
+					options.vm.NICs = vmNICs(options.ci.nics, options.network)
+					err = mgr.Create(name, baseImage, &options.vm, options.ci.config, options.dataDisks...)
+				}
 				if err != nil {
+					_ = mgr.ReleaseReservations(reservations)
 					return err
 				}
 
-				err = mgr.Create(name, baseImage, &options.vm, options.ci.config)
+				err = mgr.SetKnownHost(name, hostKey.Public)
+				if err != nil {
+					return err
+				}
+				err = mgr.SetSSHConfig(name, vu.SSHHost{
+					User:         options.ci.user,
+					IdentityFile: identityFile(options.ci.sshPubKeyFile),
+				})
 				if err != nil {
 					return err
 				}
@@ -74,29 +275,31 @@ func newCreateCmd(mgr *vu.Manager) *cobra.Command {
 		ValidArgsFunction: completeBaseImageFunc(mgr, &mgr.BaseImagePool, 1),
 	}
 	options.bindFlags(cmd)
+	cmd.Flags().StringVar(&options.image, "image", "", "base image. if set all arguments are names of new VMs.")
+	cmd.Flags().StringVar(&options.template, "template", "", "template with the defaults for the flags")
+	_ = cmd.RegisterFlagCompletionFunc("template", completeTemplateFunc)
 	return cmd
 }
 
 func newRemoveCmd(mgr *vu.Manager) *cobra.Command {
+	var (
+		force   bool
+		timeout time.Duration
+	)
 	cmd := &cobra.Command{
 		Use:     "remove NAME...",
 		Short:   "remove VMs",
 		Aliases: []string{"rm"},
 		Args:    cobra.MinimumNArgs(1),
+		Long: `Removes VMs and their images. Running VMs are shut down first and are
+stopped forcefully if they do not shut down within the timeout.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			names := args
-
-			for _, name := range names {
-				err := mgr.Remove(name)
-				if err != nil {
-					return err
-				}
-			}
-
-			return nil
+			return mgr.Remove(force, timeout, args...)
 		},
 		ValidArgsFunction: completeVMFunc(mgr),
 	}
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "stop running VMs immediately instead of shutting them down")
+	cmd.Flags().DurationVar(&timeout, "timeout", defaultShutdownTimeout, "time to wait for running VMs to shut down (0 waits forever)")
 	return cmd
 }
 
@@ -113,7 +316,12 @@ func newStartCmd(mgr *vu.Manager) *cobra.Command {
 					return err
 				}
 			}
-			return nil
+
+			defaults, err := defaultSSHHost()
+			if err != nil {
+				return err
+			}
+			return mgr.RefreshSSHConfig(defaults, names...)
 		},
 		ValidArgsFunction: completeVMFunc(mgr),
 	}
@@ -167,25 +375,62 @@ func newShowCmd(mgr *vu.Manager) *cobra.Command {
 	return cmd
 }
 
+// defaultShutdownTimeout is the default time to wait for a VM to shut down.
+const defaultShutdownTimeout = 30 * time.Second
+
 func newShutdownCmd(mgr *vu.Manager) *cobra.Command {
-	var force bool
+	opts := vu.ShutdownOptions{}
 	cmd := &cobra.Command{
 		Use:   "shutdown NAME...",
 		Short: "shutdown VMs",
-		Args:  cobra.MinimumNArgs(1),
+		Long: `Asks the guests of the VMs to shut down. With --wait the command returns
+when the VMs are shut off. If a VM does not shut down within the timeout an
+error is returned or with --force-after the VM is stopped forcefully.`,
+		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			names := args
-			for _, name := range names {
-				err := mgr.VM.Shutdown(name, force)
-				if err != nil {
-					return err
-				}
+			if opts.ForceAfter {
+				opts.Wait = true
+			}
+			return mgr.Shutdown(opts, args...)
+		},
+		ValidArgsFunction: completeVMFunc(mgr),
+	}
+	cmd.Flags().BoolVarP(&opts.Force, "force", "f", false, "force shutdown")
+	cmd.Flags().BoolVarP(&opts.Wait, "wait", "w", false, "wait until the VMs are shut off")
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", defaultShutdownTimeout, "time to wait for the VMs to shut down (0 waits forever)")
+	cmd.Flags().BoolVar(&opts.ForceAfter, "force-after", false, "stop VMs forcefully which do not shut down within the timeout (implies --wait)")
+	return cmd
+}
+
+func newResizeCmd(mgr *vu.Manager) *cobra.Command {
+	size := vm.Size{}
+	cmd := &cobra.Command{
+		Use:   "resize NAME",
+		Short: "change the disk size, memory and CPUs of a VM",
+		Long: `Changes the disk size, the memory and the number of vCPUs of a VM. The
+disk can only grow. The partition and file system in the VM are grown by
+cloud-init on the next boot. Changes which are not possible on a running VM
+are applied on its next start.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if size == (vm.Size{}) {
+				return fmt.Errorf("nothing to resize: set --disk-size, --memory or --cpu")
+			}
+			restart, err := mgr.VM.Resize(name, size)
+			if err != nil {
+				return err
+			}
+			if restart {
+				fmt.Fprintf(os.Stderr, "some changes are applied on the next start of vm '%s'\n", name)
 			}
 			return nil
 		},
 		ValidArgsFunction: completeVMFunc(mgr),
 	}
-	cmd.Flags().BoolVarP(&force, "force", "f", false, "force shutdown")
+	cmd.Flags().Var(NewByteSize(&size.DiskSize), "disk-size", "new size of the disk")
+	cmd.Flags().Var(NewByteSize(&size.Memory), "memory", "new amount of memory")
+	cmd.Flags().UintVar(&size.CPUCount, "cpu", 0, "new number of vCPUs")
 	return cmd
 }
 
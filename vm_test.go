@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_createArgs(t *testing.T) {
+	is := is.New(t)
+
+	image, names, err := createArgs("", []string{"base.img", "vm1", "vm2"})
+	is.NoErr(err)
+	is.Equal(image, "base.img")
+	is.Equal(names, []string{"vm1", "vm2"})
+
+	_, _, err = createArgs("", []string{"vm1"})
+	is.True(err != nil) // no base image
+
+	// --image or template
+	image, names, err = createArgs("template.img", []string{"vm1", "vm2"})
+	is.NoErr(err)
+	is.Equal(image, "template.img")
+	is.Equal(names, []string{"vm1", "vm2"}) // all arguments are names
+}
+
+func Test_checkCount(t *testing.T) {
+	is := is.New(t)
+
+	o := &cloudInitOptions{
+		nicFlags: []string{"network=lab", "network=wan,mac=52:54:00:00:00:01"},
+	}
+	is.NoErr(o.checkCount(1))
+	is.True(o.checkCount(2) != nil) // duplicate MAC addresses
+
+	o.nicFlags = []string{"network=lab"}
+	is.NoErr(o.checkCount(2))
+}